@@ -1,11 +1,17 @@
 package xflags
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"strings"
+	"text/template"
 )
 
 // TODO: Allow packages to declare global flags that are accessible on init.
@@ -25,34 +31,151 @@ type Commander interface {
 // terminator if it is enabled.
 type HandlerFunc func(args []string) int
 
+// A HandlerFuncC is like a HandlerFunc but also receives the context given to
+// Command.RunContext so that handlers may observe cancellation and deadlines.
+type HandlerFuncC func(ctx context.Context, args []string) int
+
+// ErrorHandling defines how Command.Parse behaves if the command line cannot be
+// parsed.
+type ErrorHandling int
+
+// These constants cause Command.Parse to behave as described if the command
+// line cannot be parsed.
+const (
+	ContinueOnError ErrorHandling = iota // Return a descriptive error.
+	ExitOnError                          // Call os.Exit(2), or the code given to ExitCodes, or for -h/--help Exit(0).
+	PanicOnError                         // Call panic with a descriptive error.
+)
+
+// exit is called to terminate the program if a command uses ExitOnError. It is
+// a variable so it may be replaced in tests.
+var exit = os.Exit
+
+// ArgsValidator is a function that validates the arguments of a command after
+// all flags are parsed. Any error returned is reported as an ArgumentError.
+type ArgsValidator func(cmd *Command, args []string) error
+
+// ExactArgs returns an ArgsValidator that requires exactly n arguments.
+func ExactArgs(n int) ArgsValidator {
+	return func(cmd *Command, args []string) error {
+		if len(args) != n {
+			return newArgErr(cmd, nil, "", "expected %d arguments, got %d", n, len(args))
+		}
+		return nil
+	}
+}
+
+// MinimumNArgs returns an ArgsValidator that requires at least n arguments.
+func MinimumNArgs(n int) ArgsValidator {
+	return func(cmd *Command, args []string) error {
+		if len(args) < n {
+			return newArgErr(cmd, nil, "", "expected at least %d arguments, got %d", n, len(args))
+		}
+		return nil
+	}
+}
+
+// MaximumNArgs returns an ArgsValidator that allows at most n arguments.
+func MaximumNArgs(n int) ArgsValidator {
+	return func(cmd *Command, args []string) error {
+		if len(args) > n {
+			return newArgErr(cmd, nil, "", "expected at most %d arguments, got %d", n, len(args))
+		}
+		return nil
+	}
+}
+
+// RangeArgs returns an ArgsValidator that requires between min and max
+// arguments, inclusive.
+func RangeArgs(min, max int) ArgsValidator {
+	return func(cmd *Command, args []string) error {
+		if len(args) < min || len(args) > max {
+			return newArgErr(
+				cmd,
+				nil,
+				"",
+				"expected between %d and %d arguments, got %d",
+				min,
+				max,
+				len(args),
+			)
+		}
+		return nil
+	}
+}
+
 // Command describes a command that users may invoke from the command line.
 //
 // Programs should not create Command directly and instead use the Command
 // function to build one with proper error checking.
 type Command struct {
-	Parent         *Command
-	Name           string
-	Usage          string
-	Synopsis       string
-	Hidden         bool
-	WithTerminator bool
-	FlagGroups     []*FlagGroup
-	Subcommands    []*Command
-	FormatFunc     FormatFunc
-	HandlerFunc    HandlerFunc
-	Stdout         io.Writer
-	Stderr         io.Writer
-
-	args []string
+	Parent                *Command
+	Name                  string
+	Usage                 string
+	Synopsis              string
+	Hidden                bool
+	DefaultSubcommand     string
+	Deprecated            string
+	Version               string
+	VersionExits          bool
+	WithTerminator        bool
+	Terminator            string
+	StopAtFirstPositional bool
+	AllowExtraArgs        bool
+	CaseInsensitiveFlags  bool
+	SortFlags             bool
+	SortCommands          bool
+	ShowDefaults          bool
+	AllowAbbreviations    bool
+	IgnoreUnknownFlags    bool
+	SilenceUsage          bool
+	UsageOnError          bool
+	SilenceErrors         bool
+	UsageExitCode         int
+	ArgErrorExitCode      int
+	ErrorHandling         ErrorHandling
+	FlagGroups            []*FlagGroup
+	Subcommands           []*Command
+	ArgsValidator         ArgsValidator
+	RequiredTogether      [][]string
+	ConfigFlag            string
+	EnvPrefix             string
+	ResponseFiles         bool
+	UsagePrefix           string
+	UsageLines            []string
+	RequiredMarker        RequiredMarker
+	HelpWidth             int
+	ColorMode             ColorMode
+	UsageLineFunc         func(cmd *Command) string
+	NormalizeFunc         func(args []string) []string
+	FormatFunc            FormatFunc
+	HandlerFunc           HandlerFunc
+	HandlerFuncC          HandlerFuncC
+	Stdin                 io.Reader
+	Stdout                io.Writer
+	Stderr                io.Writer
+
+	args        []string
+	extraArgs   []string
+	unknownArgs []string
+	seen        map[*Flag]int
 }
 
 // Command implements the Commander interface.
 func (c *Command) Command() (*Command, error) {
 	flagsByName := make(map[string]*Flag)
+	positionalsByName := make(map[string]*Flag)
 	hasUnboundedPositional := false
 	for _, group := range c.FlagGroups {
 		for _, flag := range group.Flags {
+			if v, ok := flag.Value.(*fileValue); ok {
+				v.cmd = c
+			}
 			if flag.Positional {
+				if _, ok := positionalsByName[flag.name()]; ok {
+					return nil, errorf("%s: positional argument already declared: %s", c.Name, flag)
+				}
+				positionalsByName[flag.name()] = flag
 				if len(c.Subcommands) > 0 {
 					return nil, errorf(
 						"%s: cannot specify both subcommands and"+
@@ -71,15 +194,14 @@ func (c *Command) Command() (*Command, error) {
 					hasUnboundedPositional = true
 				}
 			}
-			if flag.Name != "" {
-				key := "--" + flag.Name
-				if _, ok := flagsByName[key]; ok {
-					return nil, errorf("%s: flag already declared: %s", c.Name, key)
-				}
-				flagsByName[key] = flag
+			keys := flag.keys()
+			if flag.Negatable {
+				keys = append(keys, "--no-"+flag.Name)
 			}
-			if flag.ShortName != "" {
-				key := "-" + flag.ShortName
+			for _, key := range keys {
+				if c.CaseInsensitiveFlags && isDoubleDash(key) {
+					key = strings.ToLower(key)
+				}
 				if _, ok := flagsByName[key]; ok {
 					return nil, errorf("%s: flag already declared: %s", c.Name, key)
 				}
@@ -87,16 +209,125 @@ func (c *Command) Command() (*Command, error) {
 			}
 		}
 	}
+	if err := c.checkDefaultFrom(flagsByName); err != nil {
+		return nil, err
+	}
+	if c.ConfigFlag != "" {
+		flag := c.configFileFlag()
+		if flag == nil {
+			return nil, errorf("%s: config file flag not declared: --%s", c.Name, c.ConfigFlag)
+		}
+		if _, ok := flag.Value.(fmt.Stringer); !ok {
+			return nil, errorf("%s: config file flag does not implement fmt.Stringer: --%s", c.Name, c.ConfigFlag)
+		}
+	}
+	if c.EnvPrefix != "" && !isEnvVarName(c.EnvPrefix) {
+		return nil, errorf("%s: invalid environment variable prefix: %q", c.Name, c.EnvPrefix)
+	}
+	if c.Terminator != "" && c.Terminator != terminator && strings.HasPrefix(c.Terminator, "-") {
+		return nil, errorf("%s: invalid terminator: %s", c.Name, c.Terminator)
+	}
+	if c.DefaultSubcommand != "" {
+		ok := false
+		for _, sub := range c.Subcommands {
+			ok = ok || sub.Name == c.DefaultSubcommand
+		}
+		if !ok {
+			return nil, errorf("%s: default subcommand not found: %s", c.Name, c.DefaultSubcommand)
+		}
+	}
+	for _, names := range c.RequiredTogether {
+		if len(names) < 2 {
+			return nil, errorf("%s: at least two flags must be required together", c.Name)
+		}
+		for _, name := range names {
+			key := "--" + name
+			if c.CaseInsensitiveFlags {
+				key = strings.ToLower(key)
+			}
+			if _, ok := flagsByName[key]; !ok {
+				return nil, errorf("%s: flag required together not declared: --%s", c.Name, name)
+			}
+		}
+	}
 	return c, nil
 }
 
 func (c *Command) String() string { return c.Name }
 
+// checkDefaultFrom checks that each flag that derives its default from another
+// flag names a regular flag of this command and that no flags derive their
+// defaults from each other in a cycle.
+func (c *Command) checkDefaultFrom(flagsByName map[string]*Flag) error {
+	source := func(flag *Flag) *Flag {
+		key := "--" + flag.DefaultFrom
+		if c.CaseInsensitiveFlags {
+			key = strings.ToLower(key)
+		}
+		return flagsByName[key]
+	}
+	for _, group := range c.FlagGroups {
+		for _, flag := range group.Flags {
+			if flag.DefaultFrom == "" {
+				continue
+			}
+			visited := map[*Flag]bool{flag: true}
+			for p := flag; p.DefaultFrom != ""; {
+				next := source(p)
+				if next == nil {
+					return errorf("%s: default flag not declared: --%s", flag, p.DefaultFrom)
+				}
+				if visited[next] {
+					return errorf("%s: cycle in default flags: --%s", flag, p.DefaultFrom)
+				}
+				visited[next] = true
+				p = next
+			}
+		}
+	}
+	return nil
+}
+
 // Args returns any command line arguments specified after the "--" terminator
-// if it was enabled. Args is only populated after the command line is
-// successfully parsed.
+// if it was enabled, and any positional arguments accepted by the command's
+// ArgsValidator. Args is only populated after the command line is successfully
+// parsed.
 func (c *Command) Args() []string { return c.args }
 
+// Reset restores the value of every flag of this command and all of its
+// subcommands to its default and clears any state recorded by a previous
+// parse, such as Args and the flags visited by Visit. This allows a command to
+// be parsed more than once, e.g. in long-running programs or tests.
+//
+// Flags created with Var are not reset as their default is not known.
+func (c *Command) Reset() {
+	c.args = nil
+	c.extraArgs = nil
+	c.unknownArgs = nil
+	c.seen = nil
+	for _, group := range c.FlagGroups {
+		for _, flag := range group.Flags {
+			if flag.reset != nil {
+				flag.reset()
+			}
+		}
+	}
+	for _, cmd := range c.Subcommands {
+		cmd.Reset()
+	}
+}
+
+// ExtraArgs returns any positional arguments that were not consumed by a
+// positional flag if AllowExtraArgs is enabled. Unlike Args, it does not
+// include arguments after the terminator. ExtraArgs is only populated after the
+// command line is successfully parsed.
+func (c *Command) ExtraArgs() []string { return c.extraArgs }
+
+// UnknownArgs returns any flags specified on the command line that were not
+// recognized if IgnoreUnknownFlags is enabled. UnknownArgs is only populated
+// after the command line is successfully parsed.
+func (c *Command) UnknownArgs() []string { return c.unknownArgs }
+
 // Arg returns the i'th argument specified after the "--" terminator if it was enabled. Arg(0) is
 // the first remaining argument after flags the terminator. Arg returns an empty string if the
 // requested element does not exist.
@@ -107,6 +338,197 @@ func (c *Command) Arg(i int) string {
 	return c.args[i]
 }
 
+// configFileFlag returns the regular flag declared by this command whose long
+// name or alias is ConfigFlag, or nil.
+func (c *Command) configFileFlag() *Flag {
+	for _, group := range c.FlagGroups {
+		for _, flag := range group.Flags {
+			if flag.Positional {
+				continue
+			}
+			for _, name := range append([]string{flag.Name}, flag.Aliases...) {
+				if name == c.ConfigFlag ||
+					(c.CaseInsensitiveFlags && strings.EqualFold(name, c.ConfigFlag)) {
+					return flag
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Lookup returns the flag with the given name, short name or alias, without
+// any leading dashes, that may be specified when this command is invoked. Flags
+// declared by this command are preferred over those inherited from its
+// ancestors. Lookup returns nil if no such flag exists.
+func (c *Command) Lookup(name string) *Flag {
+	for p := c; p != nil; p = p.Parent {
+		for _, group := range p.FlagGroups {
+			for _, flag := range group.Flags {
+				if flag.Name == name || flag.ShortName == name {
+					return flag
+				}
+				for _, alias := range flag.Aliases {
+					if alias == name {
+						return flag
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Set sets the value of the flag with the given name, short name or alias, as
+// returned by Lookup. The value is validated as if it were given on the command
+// line and the flag is reported by Visit as having been set.
+func (c *Command) Set(name, value string) error {
+	flag := c.Lookup(name)
+	if flag == nil {
+		return errorf("%s: no such flag: %s", c.Name, name)
+	}
+	if err := flag.Set(value); err != nil {
+		return wrapArgErr(err, c, flag, value)
+	}
+	if c.seen == nil {
+		c.seen = make(map[*Flag]int)
+	}
+	c.seen[flag]++
+	return nil
+}
+
+// VisitAll calls fn for each flag declared by this command in the order they
+// were declared, followed by the flags returned by InheritedFlags.
+func (c *Command) VisitAll(fn func(*Flag)) {
+	for _, group := range c.FlagGroups {
+		for _, flag := range group.Flags {
+			fn(flag)
+		}
+	}
+	for _, flag := range c.InheritedFlags() {
+		fn(flag)
+	}
+}
+
+// Visit is like VisitAll but only calls fn for flags that were set on the
+// command line, or from a config file or environment variable, when the
+// command line was last parsed.
+func (c *Command) Visit(fn func(*Flag)) {
+	c.VisitAll(func(flag *Flag) {
+		if c.seen[flag] > 0 {
+			fn(flag)
+		}
+	})
+}
+
+// Changed returns true if the flag with the given name, short name or alias, as
+// returned by Lookup, was set on the command line, or from a config file or
+// environment variable, when the command line was last parsed. This
+// distinguishes a flag that was explicitly set to its zero value from one that
+// was never set. Flags set only to their default are not considered changed.
+func (c *Command) Changed(name string) bool {
+	flag := c.Lookup(name)
+	return flag != nil && c.seen[flag] > 0
+}
+
+// Close closes all files opened while parsing the flags of this command and
+// its ancestors, such as those created with OpenFile. The standard input and
+// output are not closed. The first error encountered is returned.
+func (c *Command) Close() error {
+	var err error
+	for p := c; p != nil; p = p.Parent {
+		for _, group := range p.FlagGroups {
+			for _, flag := range group.Flags {
+				if v, ok := flag.Value.(*fileValue); ok {
+					if cerr := v.Close(); err == nil {
+						err = cerr
+					}
+				}
+			}
+		}
+	}
+	return err
+}
+
+// MarshalValues returns the current value of each regular flag of this command
+// and its ancestors as a JSON object keyed by the long name of each flag. The
+// output may be read back with ConfigFile, which makes it suitable for logging
+// the effective configuration of a program or for generating a config file from
+// a command line.
+//
+// Hidden flags, sensitive flags, flags without a long name and the config file
+// flag itself are omitted. Count flags are written as an array with one true
+// element for each time the flag was counted.
+func (c *Command) MarshalValues() ([]byte, error) {
+	return c.marshalValues(false)
+}
+
+// MarshalAllValues is like MarshalValues but includes hidden flags.
+func (c *Command) MarshalAllValues() ([]byte, error) {
+	return c.marshalValues(true)
+}
+
+func (c *Command) marshalValues(includeHidden bool) ([]byte, error) {
+	var configFlag string
+	for p := c; p != nil; p = p.Parent {
+		if p.ConfigFlag != "" {
+			configFlag = p.ConfigFlag
+			break
+		}
+	}
+	values := make(map[string]interface{})
+	c.VisitAll(func(flag *Flag) {
+		if flag.Name == "" || flag.Positional || flag.Sensitive || flag.Name == configFlag {
+			return
+		}
+		if flag.Hidden && !includeHidden {
+			return
+		}
+		if _, ok := values[flag.Name]; ok {
+			return // shadowed
+		}
+		if v, ok := configValue(flag); ok {
+			values[flag.Name] = v
+		}
+	})
+	return json.MarshalIndent(values, "", "  ")
+}
+
+// InheritedFlags returns the regular flags declared by the ancestors of this
+// command which may also be specified on the command line when this command is
+// invoked. Flags that are shadowed by a flag of the same name declared by this
+// command or a nearer ancestor are excluded. The flags of the nearest ancestor
+// are returned first.
+func (c *Command) InheritedFlags() []*Flag {
+	seen := make(map[string]bool)
+	for _, group := range c.FlagGroups {
+		for _, flag := range group.Flags {
+			for _, key := range flag.keys() {
+				seen[key] = true
+			}
+		}
+	}
+	a := make([]*Flag, 0)
+	for p := c.Parent; p != nil; p = p.Parent {
+		for _, group := range p.FlagGroups {
+			for _, flag := range group.Flags {
+				if flag.Positional {
+					continue
+				}
+				shadowed := false
+				for _, key := range flag.keys() {
+					shadowed = shadowed || seen[key]
+					seen[key] = true
+				}
+				if !shadowed {
+					a = append(a, flag)
+				}
+			}
+		}
+	}
+	return a
+}
+
 // Parse parses the given set of command line arguments and stores the value of
 // each argument in each command flag's target. The rules for each flag are
 // checked and any errors are returned.
@@ -114,30 +536,363 @@ func (c *Command) Arg(i int) string {
 // If -h or --help are specified, a HelpError will be returned containing the
 // subcommand that was specified.
 //
+// If the command line cannot be parsed, the behavior of Parse is determined by
+// the command's ErrorHandling mode. By default, the error is returned.
+//
 // The returned *Command will be this command or one of its subcommands if
-// specified by the command line arguments.
+// specified by the command line arguments. The remaining arguments and the
+// flags that were set are recorded on the command, so Parse is not safe for
+// concurrent use. See ParseArgs.
 func (c *Command) Parse(args []string) (*Command, error) {
-	cmd, args, err := newArgParser(c, args).Parse()
+	return c.parse(newArgParser(c, args))
+}
+
+// ParseReader is like Parse but reads the command line arguments from r. The
+// arguments are separated by whitespace, including newlines, and may be quoted
+// or escaped as in a POSIX shell so that they may include whitespace. See
+// SplitArgs. E.g.
+//
+//     # build options
+//     --name "my widget"
+//     --label 'team=platform'
+//
+// A "#" at the start of an argument begins a comment that continues to the end
+// of the line. No variables or wildcards are expanded. Errors reading from r or
+// unterminated quotes are returned as is, regardless of the command's
+// ErrorHandling mode.
+func (c *Command) ParseReader(r io.Reader) (*Command, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	args, err := SplitArgs(string(b))
+	if err != nil {
+		return nil, err
+	}
+	return c.Parse(args)
+}
+
+// ParseWithEnv is like Parse but resolves environment variables from the given
+// map instead of the process environment. It is the preferred way to test how
+// flags are resolved from environment variables without modifying the
+// environment of the test process.
+func (c *Command) ParseWithEnv(args []string, env map[string]string) (*Command, error) {
+	p := newArgParser(c, args)
+	p.lookupEnv = func(key string) (string, bool) {
+		s, ok := env[key]
+		return s, ok
+	}
+	return c.parse(p)
+}
+
+// ParseResult describes the outcome of parsing a command line with ParseArgs.
+type ParseResult struct {
+	Command     *Command // The command or subcommand that was invoked.
+	Args        []string // Arguments as returned by Command.Args.
+	ExtraArgs   []string // Arguments as returned by Command.ExtraArgs.
+	UnknownArgs []string // Arguments as returned by Command.UnknownArgs.
+
+	seen map[*Flag]int
+}
+
+// Visit calls fn for each flag of the invoked command and its ancestors that
+// was set on the command line, or from a config file or environment variable.
+func (r *ParseResult) Visit(fn func(*Flag)) {
+	r.Command.VisitAll(func(flag *Flag) {
+		if r.seen[flag] > 0 {
+			fn(flag)
+		}
+	})
+}
+
+// ParseArgs is like Parse but returns the outcome of parsing in a ParseResult
+// instead of recording it on the command. The command itself is not modified,
+// so ParseArgs may be called concurrently from multiple goroutines provided
+// that the values of any flags that are set are safe for concurrent use.
+// Flags created with the typed constructors such as String or Int all write to
+// the same target variable and are not safe for concurrent use.
+func (c *Command) ParseArgs(args []string) (*ParseResult, error) {
+	return c.parseResult(newArgParser(c, args))
+}
+
+func (c *Command) parse(p *argParser) (*Command, error) {
+	r, err := c.parseResult(p)
 	if err != nil {
 		return nil, err
 	}
-	cmd.args = args
+	cmd := r.Command
+	cmd.args = r.Args
+	cmd.extraArgs = r.ExtraArgs
+	cmd.unknownArgs = r.UnknownArgs
+	for q := cmd; q != nil; q = q.Parent {
+		q.seen = r.seen
+	}
 	return cmd, nil
 }
 
-// output returns stdout and stderr, inheriting from parents and defaulting to
-// OS defaults.
+func (c *Command) parseResult(p *argParser) (*ParseResult, error) {
+	cmd, args, err := p.Parse()
+	if err != nil {
+		// close any files opened before the error
+		p.cmd.Close()
+		switch c.ErrorHandling {
+		case ExitOnError:
+			code := c.handleErr(err)
+			if code != 0 && !hasArgErrorExitCode(c, err) {
+				code = 2
+			}
+			exit(code)
+		case PanicOnError:
+			panic(err)
+		}
+		return nil, err
+	}
+	return &ParseResult{
+		Command:     cmd,
+		Args:        args,
+		ExtraArgs:   p.extraArgs,
+		UnknownArgs: p.unknownArgs,
+		seen:        p.flagsSeen,
+	}, nil
+}
+
+// terminatorToken returns the token that terminates parsing of this command's
+// arguments, inherited from the nearest command that enables WithTerminator.
+// It returns an empty string if no terminator is enabled.
+func (c *Command) terminatorToken() string {
+	for p := c; p != nil; p = p.Parent {
+		if !p.WithTerminator {
+			continue
+		}
+		if p.Terminator != "" {
+			return p.Terminator
+		}
+		return terminator
+	}
+	return ""
+}
+
+// output returns stdout and stderr, each inherited from the nearest ancestor
+// that sets it and defaulting to OS defaults.
 func (c *Command) output() (stdout, stderr io.Writer) {
-	stdout, stderr = c.Stdout, c.Stderr
-	if stdout == nil && stderr == nil {
-		if c.Parent != nil {
-			return c.Parent.output()
+	for p := c; p != nil && (stdout == nil || stderr == nil); p = p.Parent {
+		if stdout == nil {
+			stdout = p.Stdout
+		}
+		if stderr == nil {
+			stderr = p.Stderr
 		}
-		return os.Stdout, os.Stderr
+	}
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	if stderr == nil {
+		stderr = os.Stderr
 	}
 	return
 }
 
+// input returns stdin, inheriting from parents and defaulting to os.Stdin.
+func (c *Command) input() io.Reader {
+	for p := c; p != nil; p = p.Parent {
+		if p.Stdin != nil {
+			return p.Stdin
+		}
+	}
+	return os.Stdin
+}
+
+// caseInsensitiveFlags returns true if this command or any of its ancestors
+// matches long flag names case-insensitively.
+func (c *Command) caseInsensitiveFlags() bool {
+	for p := c; p != nil; p = p.Parent {
+		if p.CaseInsensitiveFlags {
+			return true
+		}
+	}
+	return false
+}
+
+// allowAbbreviations returns true if this command or any of its ancestors
+// allows long flag names to be abbreviated.
+func (c *Command) allowAbbreviations() bool {
+	for p := c; p != nil; p = p.Parent {
+		if p.AllowAbbreviations {
+			return true
+		}
+	}
+	return false
+}
+
+// envPrefix returns the prefix of environment variable names derived for the
+// flags of this command. The prefix of each command extends the prefix of its
+// parent.
+func (c *Command) envPrefix() string {
+	var prefix string
+	if c.Parent != nil {
+		prefix = c.Parent.envPrefix()
+	}
+	if c.EnvPrefix == "" {
+		return prefix
+	}
+	if prefix == "" {
+		return c.EnvPrefix
+	}
+	return prefix + "_" + c.EnvPrefix
+}
+
+// envVarName returns the name of the environment variable from which a flag
+// declared by cmd may be set. If the flag specifies no environment variable,
+// the name is derived from the flag name and the prefix of cmd, if any.
+func envVarName(cmd *Command, flag *Flag) string {
+	if flag.EnvVar != "" {
+		return flag.EnvVar
+	}
+	prefix := cmd.envPrefix()
+	if prefix == "" {
+		return ""
+	}
+	name := strings.Replace(flag.name(), "-", "_", -1)
+	return strings.ToUpper(prefix + "_" + name)
+}
+
+// isEnvVarName returns true if s is a portable environment variable name that
+// may be set from a shell: letters, digits and underscores, not starting with a
+// digit.
+func isEnvVarName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ignoreUnknownFlags returns true if this command or any of its ancestors
+// collects unrecognized flags instead of returning an error.
+func (c *Command) ignoreUnknownFlags() bool {
+	for p := c; p != nil; p = p.Parent {
+		if p.IgnoreUnknownFlags {
+			return true
+		}
+	}
+	return false
+}
+
+// sortFlags returns true if this command or any of its ancestors shows flags
+// in alphabetical order in help messages.
+func (c *Command) sortFlags() bool {
+	for p := c; p != nil; p = p.Parent {
+		if p.SortFlags {
+			return true
+		}
+	}
+	return false
+}
+
+// sortCommands returns true if this command or any of its ancestors shows
+// subcommands in alphabetical order in help messages.
+func (c *Command) sortCommands() bool {
+	for p := c; p != nil; p = p.Parent {
+		if p.SortCommands {
+			return true
+		}
+	}
+	return false
+}
+
+// responseFiles returns true if this command or any of its ancestors expands
+// response files.
+func (c *Command) responseFiles() bool {
+	for p := c; p != nil; p = p.Parent {
+		if p.ResponseFiles {
+			return true
+		}
+	}
+	return false
+}
+
+// versionCommand returns the nearest of this command and its ancestors that
+// specifies a version string, or nil if none do.
+func (c *Command) versionCommand() *Command {
+	for p := c; p != nil; p = p.Parent {
+		if p.Version != "" {
+			return p
+		}
+	}
+	return nil
+}
+
+// version returns the version string of this command, inherited from its
+// ancestors if not specified.
+func (c *Command) version() string {
+	if p := c.versionCommand(); p != nil {
+		return p.Version
+	}
+	return ""
+}
+
+// usageOnError returns true if this command or any of its ancestors prints its
+// usage line after an argument error.
+func (c *Command) usageOnError() bool {
+	for p := c; p != nil; p = p.Parent {
+		if p.UsageOnError {
+			return true
+		}
+	}
+	return false
+}
+
+// silenceUsage returns true if this command or any of its ancestors suppresses
+// usage information when a command without a handler is invoked.
+func (c *Command) silenceUsage() bool {
+	for p := c; p != nil; p = p.Parent {
+		if p.SilenceUsage {
+			return true
+		}
+	}
+	return false
+}
+
+// silenceErrors returns true if this command or any of its ancestors
+// suppresses error messages.
+func (c *Command) silenceErrors() bool {
+	for p := c; p != nil; p = p.Parent {
+		if p.SilenceErrors {
+			return true
+		}
+	}
+	return false
+}
+
+// usageExitCode returns the exit code for invoking a command without a handler,
+// inherited from the nearest ancestor that sets one. The default is 1.
+func (c *Command) usageExitCode() int {
+	for p := c; p != nil; p = p.Parent {
+		if p.UsageExitCode != 0 {
+			return p.UsageExitCode
+		}
+	}
+	return 1
+}
+
+// argErrorExitCode returns the exit code for command lines that cannot be
+// parsed, inherited from the nearest ancestor that sets one. The default is 1.
+func (c *Command) argErrorExitCode() int {
+	for p := c; p != nil; p = p.Parent {
+		if p.ArgErrorExitCode != 0 {
+			return p.ArgErrorExitCode
+		}
+	}
+	return 1
+}
+
 // Run parses the given set of command line arguments and calls the handler
 // for the command or subcommand specified by the arguments.
 //
@@ -147,20 +902,48 @@ func (c *Command) output() (stdout, stderr io.Writer) {
 // If a command is invoked that has no handler, usage information will be
 // printed to os.Stderr and the return code will be non-zero.
 func (c *Command) Run(args []string) int {
+	return c.RunContext(context.Background(), args)
+}
+
+// RunContext is like Run but passes the given context to the handler of the
+// command if it was registered with HandleFuncC.
+func (c *Command) RunContext(ctx context.Context, args []string) int {
 	target, err := c.Parse(args)
 	if err != nil {
 		return c.handleErr(err)
 	}
+	if target.HandlerFuncC != nil {
+		return target.HandlerFuncC(ctx, target.args)
+	}
 	if target.HandlerFunc == nil {
+		if target.silenceUsage() {
+			return target.usageExitCode()
+		}
 		_, stderr := target.output()
 		if err := target.WriteUsage(stderr); err != nil {
 			panic(err)
 		}
-		return 1
+		return target.usageExitCode()
 	}
 	return target.HandlerFunc(target.args)
 }
 
+// hasArgErrorExitCode returns true if the command that failed to parse err, or
+// any of its ancestors, specifies an exit code for argument errors with
+// ExitCodes.
+func hasArgErrorExitCode(cmd *Command, err error) bool {
+	var argErr *ArgumentError
+	if errors.As(err, &argErr) {
+		cmd = argErr.Cmd
+	}
+	for p := cmd; p != nil; p = p.Parent {
+		if p.ArgErrorExitCode != 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *Command) handleErr(err error) int {
 	if err == nil {
 		return 0
@@ -168,21 +951,33 @@ func (c *Command) handleErr(err error) int {
 	var helpErr *HelpError
 	if errors.As(err, &helpErr) {
 		stdout, _ := helpErr.Cmd.output()
-		if stdout != os.Stdout {
-			if f, ok := stdout.(*os.File); ok {
-				panic(f.Name())
-			}
-			panic(stdout)
-		}
-		if err := helpErr.Cmd.WriteUsage(stdout); err != nil {
+		if err := helpErr.Cmd.writeUsage(stdout, helpErr.ShowHidden); err != nil {
 			panic(err)
 		}
 		return 0
 	}
+	var versionErr *VersionError
+	if errors.As(err, &versionErr) {
+		stdout, _ := versionErr.Cmd.output()
+		fmt.Fprintln(stdout, versionErr.Cmd.version())
+		return 0
+	}
 	var argErr *ArgumentError
 	if errors.As(err, &argErr) {
+		if argErr.Cmd.silenceErrors() {
+			return argErr.Cmd.argErrorExitCode()
+		}
 		_, stderr := argErr.Cmd.output()
 		fmt.Fprintf(stderr, "Argument error: %s\n", argErr.String())
+		if argErr.Cmd.usageOnError() {
+			if err := printUsage(stderr, argErr.Cmd); err != nil {
+				panic(err)
+			}
+			fmt.Fprintf(stderr, "Run '%s --help' for more information.\n", fullName(argErr.Cmd, " "))
+		}
+		return argErr.Cmd.argErrorExitCode()
+	}
+	if c.silenceErrors() {
 		return 1
 	}
 	_, stderr := c.output()
@@ -190,15 +985,70 @@ func (c *Command) handleErr(err error) int {
 	return 1
 }
 
-// WriteUsage prints a help message to the given Writer using the configured
-// Formatter.
+// WriteUsage prints a help message to the given Writer using the FormatFunc
+// of this command or its nearest ancestor, or DefaultFormat if none is
+// configured.
 func (c *Command) WriteUsage(w io.Writer) error {
+	return c.writeUsage(w, false)
+}
+
+// ToFlagSet returns a flag.FlagSet containing the regular flags of this
+// command and its ancestors, for use with packages that expect one. Each flag
+// is registered under its long name with the same Value, so setting a flag in
+// the FlagSet sets it for this command too.
+//
+// Short names, aliases, flag groups, positional flags and any rules such as
+// required flags or validation are not exported. Flags without a long name are
+// registered under their short name. Values must implement flag.Value, which
+// all values created by this package do.
+func (c *Command) ToFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	c.VisitAll(func(f *Flag) {
+		if f.Positional {
+			return
+		}
+		name := f.Name
+		if name == "" {
+			name = f.ShortName
+		}
+		v, ok := f.Value.(flag.Value)
+		if !ok || fs.Lookup(name) != nil {
+			return // not a flag.Value or shadowed
+		}
+		fs.Var(v, name, f.Usage)
+	})
+	return fs
+}
+
+// PrintDefaults prints only the options section of the help message of this
+// command to w, including the flags inherited from its ancestors, in the
+// same format as WriteUsage. It is useful for embedding the options of a
+// command in other documentation.
+func (c *Command) PrintDefaults(w io.Writer) error {
+	buf := &bytes.Buffer{}
+	if err := detailFlagGroups(buf, c, newHelpStyle(w, c)); err != nil {
+		return err
+	}
+	_, err := w.Write(bytes.TrimPrefix(buf.Bytes(), []byte("\n")))
+	return err
+}
+
+// writeUsage prints a help message using the configured FormatFunc. If
+// showHidden is true and no FormatFunc is configured, hidden flags and commands
+// are included.
+func (c *Command) writeUsage(w io.Writer, showHidden bool) error {
 	f := c.FormatFunc
 	for p := c; f == nil && p != nil; p = p.Parent {
 		f = p.FormatFunc
 	}
 	if f == nil {
-		f = Format
+		f = DefaultFormat
+		if f == nil {
+			f = Format
+		}
+		if showHidden {
+			return f(w, unhide(c))
+		}
 	}
 	return f(w, c)
 }
@@ -210,6 +1060,8 @@ type CommandBuilder struct {
 	cmd         Command
 	flagGroups  []*flagGroupBuilder
 	subcommands []Commander
+	completion  bool
+	helpCommand bool
 	err         error
 }
 
@@ -218,8 +1070,9 @@ type CommandBuilder struct {
 func NewCommand(name, usage string) *CommandBuilder {
 	c := &CommandBuilder{
 		cmd: Command{
-			Name:  name,
-			Usage: usage,
+			Name:         name,
+			Usage:        usage,
+			VersionExits: true,
 		},
 		flagGroups:  make([]*flagGroupBuilder, 1, 8),
 		subcommands: make([]Commander, 0, 8),
@@ -254,6 +1107,84 @@ func (c *CommandBuilder) HandleFunc(
 	return c
 }
 
+// HandleFuncC registers a handler for the command which receives the context
+// given to Command.RunContext or RunContext. If both HandleFunc and HandleFuncC
+// are specified, only the handler registered with HandleFuncC is called.
+func (c *CommandBuilder) HandleFuncC(
+	handler func(ctx context.Context, args []string) int,
+) *CommandBuilder {
+	if handler == nil {
+		return c.error(errorf("%s: nil handler", c.cmd.Name))
+	}
+	c.cmd.HandlerFuncC = handler
+	return c
+}
+
+// Version specifies a version string for the command. If --version or -V is
+// specified on the command line, the version string is printed to the standard
+// output. Either flag may be overridden by declaring a flag of the same name.
+// Subcommands inherit the version string unless they specify their own.
+func (c *CommandBuilder) Version(s string) *CommandBuilder {
+	c.cmd.Version = s
+	return c
+}
+
+// VersionExits specifies whether parsing stops after the version string is
+// printed. If true, the default, --version is handled like --help and Run
+// returns 0 without calling the handler. If false, the version string is
+// printed and parsing continues so the handler is called as usual.
+func (c *CommandBuilder) VersionExits(exits bool) *CommandBuilder {
+	c.cmd.VersionExits = exits
+	return c
+}
+
+// SilenceUsage suppresses the usage information that is printed when a command
+// without a handler is invoked. The exit code is unaffected. Subcommands
+// inherit this setting.
+func (c *CommandBuilder) SilenceUsage() *CommandBuilder {
+	c.cmd.SilenceUsage = true
+	return c
+}
+
+// UsageOnError specifies that the usage line of a command is printed after any
+// error message when its command line cannot be parsed, such as when a required
+// flag is missing, together with a hint to run the command with --help for more
+// information. Use ExitCodes to also change the exit code. Subcommands inherit
+// this setting.
+func (c *CommandBuilder) UsageOnError() *CommandBuilder {
+	c.cmd.UsageOnError = true
+	return c
+}
+
+// ExitCodes sets the exit codes returned by Run when a command without a
+// handler is invoked and usage information is printed, and when the command
+// line cannot be parsed, respectively. Both default to 1. Programs that follow
+// the convention of the standard flag package may use ExitCodes(2, 2). A code
+// of zero leaves the default unchanged. Subcommands inherit this setting.
+//
+// Commands that use ExitOnError exit with 2 when the command line cannot be
+// parsed, unless an argError code is given.
+func (c *CommandBuilder) ExitCodes(usage, argError int) *CommandBuilder {
+	c.cmd.UsageExitCode = usage
+	c.cmd.ArgErrorExitCode = argError
+	return c
+}
+
+// SilenceErrors suppresses the error messages that are printed when the command
+// line cannot be parsed. The exit code is unaffected. Subcommands inherit this
+// setting.
+func (c *CommandBuilder) SilenceErrors() *CommandBuilder {
+	c.cmd.SilenceErrors = true
+	return c
+}
+
+// ErrorHandling specifies how the command behaves if the command line cannot be
+// parsed. The default is ContinueOnError.
+func (c *CommandBuilder) ErrorHandling(mode ErrorHandling) *CommandBuilder {
+	c.cmd.ErrorHandling = mode
+	return c
+}
+
 // Hidden hides the command from all help messages but still allows the command
 // to be invoked on the command line.
 func (c *CommandBuilder) Hidden() *CommandBuilder {
@@ -261,12 +1192,43 @@ func (c *CommandBuilder) Hidden() *CommandBuilder {
 	return c
 }
 
+// Deprecated marks the command as deprecated. The command may still be invoked
+// but a warning including msg is printed to the standard error each time it
+// is. Deprecated commands are marked as such in help messages unless they are
+// also Hidden.
+func (c *CommandBuilder) Deprecated(msg string) *CommandBuilder {
+	c.cmd.Deprecated = msg
+	return c
+}
+
+// DefaultSubcommand specifies the name of a subcommand that is invoked if no
+// subcommand is specified on the command line. Any flags or arguments that are
+// not recognized by this command are passed to the default subcommand. E.g.
+// "app --verbose" may be equivalent to "app status --verbose".
+func (c *CommandBuilder) DefaultSubcommand(name string) *CommandBuilder {
+	c.cmd.DefaultSubcommand = name
+	return c
+}
+
 // Flag adds command line flags to the default FlagGroup for this command.
+//
+// Regular flags are persistent: they may also be specified on the command line
+// after the name of any subcommand, at any depth, unless the subcommand
+// declares a flag of the same name. Required flags and limits on the number of
+// times a flag may be given apply whichever subcommand is invoked. Help
+// messages for subcommands show them under "Global options".
 func (c *CommandBuilder) Flags(flags ...Flagger) *CommandBuilder {
 	c.flagGroups[0].append(flags...)
 	return c
 }
 
+// PersistentFlags is the same as Flags. It is provided for programs migrating
+// from packages where flags are only available to subcommands if declared as
+// persistent, as all regular flags are persistent in this package.
+func (c *CommandBuilder) PersistentFlags(flags ...Flagger) *CommandBuilder {
+	return c.Flags(flags...)
+}
+
 // FlagGroup adds a group of command line flags to this command and shows them
 // under a common heading in help messages.
 func (c *CommandBuilder) FlagGroup(
@@ -299,22 +1261,319 @@ func (c *CommandBuilder) Subcommands(commands ...Commander) *CommandBuilder {
 	return c
 }
 
-// Formatter specifies a custom Formatter for formatting help messages for this
-// command.
+// FormatFunc specifies a custom FormatFunc for formatting help messages for
+// this command and its subcommands, instead of DefaultFormat.
 func (c *CommandBuilder) FormatFunc(fn FormatFunc) *CommandBuilder {
 	c.cmd.FormatFunc = fn
 	return c
 }
 
+// HelpTemplate specifies a text/template used to print help messages for this
+// command and its subcommands, instead of the default Format. The template is
+// executed with the *Command as its data and may call the functions returned
+// by TemplateFuncs. E.g.
+//
+//     {{usageLine .}}
+//     {{range flags .}}
+//       {{rpad (flagName .) 20}}{{.Usage}}{{end}}
+//
+// It is shorthand for FormatFunc with a TemplateFormatter. An error is returned
+// when the command is built if the template cannot be parsed.
+func (c *CommandBuilder) HelpTemplate(tmpl string) *CommandBuilder {
+	t, err := template.New(c.cmd.Name).Funcs(TemplateFuncs()).Parse(tmpl)
+	if err != nil {
+		return c.error(errorf("%s: invalid help template: %v", c.cmd.Name, err))
+	}
+	return c.FormatFunc(TemplateFormatter(t))
+}
+
+// UsagePrefix specifies the text printed before the usage line in help
+// messages. The default is "Usage:". Subcommands inherit the prefix of their
+// parent unless they specify their own.
+func (c *CommandBuilder) UsagePrefix(s string) *CommandBuilder {
+	c.cmd.UsagePrefix = s
+	return c
+}
+
+// UsageLine adds a hand-written usage line to help messages, replacing the
+// line that is otherwise generated from the command's flags and subcommands.
+// The line is printed after the usage prefix. E.g. "app [OPTIONS] FILE".
+//
+// UsageLine may be called multiple times to document each form of a command
+// that may be invoked in several ways. The rest of the help message is
+// unaffected. Usage lines are not inherited by subcommands and take precedence
+// over any UsageLineFunc.
+func (c *CommandBuilder) UsageLine(s string) *CommandBuilder {
+	c.cmd.UsageLines = append(c.cmd.UsageLines, s)
+	return c
+}
+
+// UsageLineFunc specifies a function that produces the entire usage line in
+// help messages, replacing the default "Usage: name [OPTIONS] ..." line. The
+// rest of the help message is unaffected. Subcommands inherit the function of
+// their parent unless they specify their own.
+func (c *CommandBuilder) UsageLineFunc(fn func(cmd *Command) string) *CommandBuilder {
+	c.cmd.UsageLineFunc = fn
+	return c
+}
+
+// RequiredMarker specifies how required flags are marked in help messages. The
+// default is RequiredText. Subcommands inherit the style of their parent unless
+// they specify their own.
+func (c *CommandBuilder) RequiredMarker(marker RequiredMarker) *CommandBuilder {
+	c.cmd.RequiredMarker = marker
+	return c
+}
+
+// IgnoreUnknownFlags specifies that flags which are not defined by the
+// command or any of its ancestors are collected and made available via
+// Command.UnknownArgs instead of causing a parse error. Any value following an
+// unknown flag in a separate argument cannot be distinguished from a
+// positional argument and is parsed as such. Use the --flag=value form to keep
+// values with their unknown flags. Subcommands inherit this setting.
+func (c *CommandBuilder) IgnoreUnknownFlags() *CommandBuilder {
+	c.cmd.IgnoreUnknownFlags = true
+	return c
+}
+
+// ShowDefaults specifies that the default value of every flag of this command
+// and its subcommands is shown in help messages, as if ShowDefault was
+// specified for each flag. Required and sensitive flags are excluded.
+func (c *CommandBuilder) ShowDefaults() *CommandBuilder {
+	c.cmd.ShowDefaults = true
+	return c
+}
+
+// SortFlags specifies that flags are shown in alphabetical order of their
+// names within each group in help messages, instead of the order in which they
+// were declared. Positional arguments are always shown in declaration order.
+// Subcommands inherit this setting.
+func (c *CommandBuilder) SortFlags() *CommandBuilder {
+	c.cmd.SortFlags = true
+	return c
+}
+
+// SortCommands specifies that subcommands are shown in alphabetical order in
+// help messages, instead of the order in which they were declared. Subcommands
+// inherit this setting.
+func (c *CommandBuilder) SortCommands() *CommandBuilder {
+	c.cmd.SortCommands = true
+	return c
+}
+
+// HelpWidth specifies the width to which the descriptions of flags, arguments
+// and subcommands are wrapped in help messages. By default, help messages are
+// wrapped to the width of the terminal or to 80 columns if the output is not a
+// terminal. Subcommands inherit the width of their parent unless they specify
+// their own.
+func (c *CommandBuilder) HelpWidth(n int) *CommandBuilder {
+	if n < 0 {
+		return c.error(errorf("%s: invalid help width: %d", c.cmd.Name, n))
+	}
+	c.cmd.HelpWidth = n
+	return c
+}
+
+// Color specifies whether help messages are colored with ANSI escape
+// sequences, overriding the default of coloring help messages only if they are
+// written to a terminal and the NO_COLOR environment variable is not set.
+// Subcommands inherit this setting.
+func (c *CommandBuilder) Color(enabled bool) *CommandBuilder {
+	if enabled {
+		c.cmd.ColorMode = ColorAlways
+	} else {
+		c.cmd.ColorMode = ColorNever
+	}
+	return c
+}
+
+// ArgsValidator specifies a function to validate the arguments of this command
+// after all flags are parsed. Common validators are provided by ExactArgs,
+// MinimumNArgs, MaximumNArgs and RangeArgs.
+//
+// If the command has no subcommands, any positional arguments that are not
+// consumed by a positional flag are collected and passed to the validator and
+// the handler together with any arguments after the "--" terminator.
+func (c *CommandBuilder) ArgsValidator(fn ArgsValidator) *CommandBuilder {
+	if fn == nil {
+		return c.error(errorf("%s: nil args validator", c.cmd.Name))
+	}
+	c.cmd.ArgsValidator = fn
+	return c
+}
+
+// EnvPrefix specifies a prefix from which to derive the names of environment
+// variables for flags that do not specify one with FlagBuilder.Env. The name of
+// the variable is the prefix and the name of the flag joined by an underscore,
+// uppercased and with dashes replaced by underscores. E.g. with a prefix of
+// "APP", the flag --log-level is set from APP_LOG_LEVEL.
+//
+// Subcommands inherit the prefix of their parent. If a subcommand specifies
+// its own prefix, it extends the prefix of its parent. E.g. "APP_DEPLOY". The
+// prefix must be a valid environment variable name as described by
+// FlagBuilder.Env.
+func (c *CommandBuilder) EnvPrefix(prefix string) *CommandBuilder {
+	c.cmd.EnvPrefix = prefix
+	return c
+}
+
+// RequiredTogether specifies the long names of flags that must all be
+// specified if any one of them is. E.g. a certificate and its private key.
+// Flags set from a config file or environment variable count as specified. The
+// flags must be declared by this command.
+func (c *CommandBuilder) RequiredTogether(names ...string) *CommandBuilder {
+	c.cmd.RequiredTogether = append(c.cmd.RequiredTogether, names)
+	return c
+}
+
+// ConfigFile specifies the name of a flag, typically a String flag named
+// "config", whose value is the path of a JSON config file. Each key in the
+// file is the long name of a flag and sets the flag if it was not specified on
+// the command line. Arrays set the flag once for each element.
+//
+// Values are applied with the following precedence: command line arguments,
+// then the config file, then environment variables and finally the default
+// value of the flag. Subcommands inherit the config file flag of their parent.
+//
+// The flag must be a regular flag declared by this command and its Value must
+// implement fmt.Stringer, otherwise an error is returned when the command is
+// built.
+func (c *CommandBuilder) ConfigFile(flagName string) *CommandBuilder {
+	if flagName == "" {
+		return c.error(errorf("%s: config file flag name cannot be empty", c.cmd.Name))
+	}
+	c.cmd.ConfigFlag = flagName
+	return c
+}
+
+// WithHelpCommand adds a "help" subcommand to this command which prints the
+// help message of the command or of the subcommand named by its arguments. E.g.
+// "app help create" is equivalent to "app create --help".
+func (c *CommandBuilder) WithHelpCommand() *CommandBuilder {
+	c.helpCommand = true
+	return c
+}
+
+// WithCompletion adds a hidden "__complete" subcommand to this command which
+// prints completion candidates for the command line arguments given after
+// "--", one per line. Shell completion scripts created with
+// Command.WriteCompletion call back into the program using this subcommand to
+// complete values that are only known at runtime.
+func (c *CommandBuilder) WithCompletion() *CommandBuilder {
+	c.completion = true
+	return c
+}
+
+// CaseInsensitiveFlags specifies that long flag names are matched
+// case-insensitively on the command line so that "--Verbose" and "--verbose"
+// are equivalent. Short flag names are still case-sensitive so that "-v" and
+// "-V" may be different flags. Long flag names that differ only by case are
+// rejected when the command is built. Subcommands inherit this setting.
+func (c *CommandBuilder) CaseInsensitiveFlags() *CommandBuilder {
+	c.cmd.CaseInsensitiveFlags = true
+	return c
+}
+
+// AllowAbbreviations allows long flag names to be abbreviated on the command
+// line to any prefix that matches exactly one flag. E.g. "--verb" for
+// "--verbose". A flag whose name matches exactly is always preferred over
+// abbreviations and ambiguous abbreviations are rejected. Short flag names
+// cannot be abbreviated. Subcommands inherit this setting.
+func (c *CommandBuilder) AllowAbbreviations() *CommandBuilder {
+	c.cmd.AllowAbbreviations = true
+	return c
+}
+
+// Normalizer specifies a function that rewrites the command line arguments
+// before they are parsed. This is an extension point for custom argument
+// handling, such as mapping legacy flags to their new names or expanding
+// aliases. E.g.
+//
+//     Normalizer(func(args []string) []string {
+//         for i, arg := range args {
+//             if arg == "-old" {
+//                 args[i] = "--new"
+//             }
+//         }
+//         return args
+//     })
+//
+// The function is given all arguments, including any after the terminator, and
+// is called before response files are expanded, so arguments read from
+// response files are not rewritten. Subcommands inherit the normalizer of
+// their parent, but only the normalizer of the command that parses the command
+// line, or its nearest ancestor, is called.
+func (c *CommandBuilder) Normalizer(fn func(args []string) []string) *CommandBuilder {
+	c.cmd.NormalizeFunc = fn
+	return c
+}
+
+// WithResponseFiles specifies that any command line argument of the form
+// "@file" is replaced with the arguments read from the named file before the
+// command line is parsed. Arguments in the file are separated by whitespace and
+// may be quoted or escaped as described by SplitArgs. They may include other
+// response files. Arguments that start with "@" may be escaped as "@@".
+// Subcommands inherit this setting.
+func (c *CommandBuilder) WithResponseFiles() *CommandBuilder {
+	c.cmd.ResponseFiles = true
+	return c
+}
+
 // WithTerminator specifies that any command line argument after "--" will be
 // passed through to the args parameter of the command's handler without any
 // further processing.
+//
+// Subcommands inherit this setting. The arguments following the terminator are
+// given to the command that was selected when the terminator was reached. E.g.
+// for "app sub -- x y", the arguments "x" and "y" are given to "sub", while for
+// "app -- sub x", the arguments "sub" and "x" are given to "app", or to its
+// default subcommand if it has one.
 func (c *CommandBuilder) WithTerminator() *CommandBuilder {
 	c.cmd.WithTerminator = true
 	return c
 }
 
-// Output sets the destination for usage and error messages.
+// Terminator is like WithTerminator but uses the given token instead of "--".
+// E.g. "++" or ";". The token may not start with "-" as it would be confused
+// with a flag.
+func (c *CommandBuilder) Terminator(token string) *CommandBuilder {
+	c.cmd.WithTerminator = true
+	c.cmd.Terminator = token
+	return c
+}
+
+// StopAtFirstPositional specifies that flag parsing stops at the first
+// positional argument that is not consumed by a positional flag or subcommand.
+// That argument and all that follow it are passed through to the args
+// parameter of the command's handler without any further processing, as if
+// they followed the "--" terminator.
+func (c *CommandBuilder) StopAtFirstPositional() *CommandBuilder {
+	c.cmd.StopAtFirstPositional = true
+	return c
+}
+
+// AllowExtraArgs specifies that positional arguments that are not consumed by
+// a positional flag are collected and made available via Command.ExtraArgs
+// instead of causing a parse error. This is useful for commands that pass
+// arguments through to another program without requiring a terminator.
+func (c *CommandBuilder) AllowExtraArgs() *CommandBuilder {
+	c.cmd.AllowExtraArgs = true
+	return c
+}
+
+// Input sets the source from which flags that specify AllowStdin read their
+// value. The default is os.Stdin. Subcommands inherit this setting.
+func (c *CommandBuilder) Input(r io.Reader) *CommandBuilder {
+	c.cmd.Stdin = r
+	return c
+}
+
+// Output sets the destinations for help messages and error messages
+// respectively. Help and version information requested with -h, --help or
+// --version is written to stdout. Argument errors and other errors returned by
+// a handler are written to stderr. A nil writer is inherited from the parent
+// command or defaults to os.Stdout or os.Stderr. Subcommands inherit this
+// setting.
 func (c *CommandBuilder) Output(stdout, stderr io.Writer) *CommandBuilder {
 	c.cmd.Stdout, c.cmd.Stderr = stdout, stderr
 	return c
@@ -341,9 +1600,43 @@ func (c *CommandBuilder) Command() (*Command, error) {
 		cmd.Subcommands = append(cmd.Subcommands, sub)
 		sub.Parent = &cmd
 	}
+	if c.helpCommand {
+		sub, err := newHelpCommand(&cmd).Command()
+		if err != nil {
+			return nil, err
+		}
+		cmd.Subcommands = append(cmd.Subcommands, sub)
+		sub.Parent = &cmd
+	}
+	if c.completion {
+		sub, err := newCompleteCommand(&cmd).Command()
+		if err != nil {
+			return nil, err
+		}
+		cmd.Subcommands = append(cmd.Subcommands, sub)
+		sub.Parent = &cmd
+	}
+	if cmd.ShowDefaults {
+		showDefaults(&cmd)
+	}
 	return cmd.Command()
 }
 
+// showDefaults enables ShowDefault for all flags of a command and its
+// subcommands that are not required or sensitive.
+func showDefaults(cmd *Command) {
+	for _, group := range cmd.FlagGroups {
+		for _, flag := range group.Flags {
+			if flag.MinCount == 0 && !flag.Sensitive {
+				flag.ShowDefault = true
+			}
+		}
+	}
+	for _, sub := range cmd.Subcommands {
+		showDefaults(sub)
+	}
+}
+
 // Must is a helper that calls Command and panics if the error is non-nil.
 func (c *CommandBuilder) Must() *Command {
 	cmd, err := c.Command()
@@ -352,3 +1645,41 @@ func (c *CommandBuilder) Must() *Command {
 	}
 	return cmd
 }
+
+// newHelpCommand returns a builder for the help subcommand of the given root
+// command.
+func newHelpCommand(root *Command) *CommandBuilder {
+	return NewCommand("help", "Show help for a command").
+		ArgsValidator(func(cmd *Command, args []string) error { return nil }).
+		HandleFunc(func(args []string) int {
+			target := root
+			for _, name := range args {
+				var next *Command
+				names := make([]string, 0, len(target.Subcommands))
+				for _, sub := range target.Subcommands {
+					if sub.Name == name {
+						next = sub
+						break
+					}
+					if !sub.Hidden {
+						names = append(names, sub.Name)
+					}
+				}
+				if next == nil {
+					_, stderr := root.output()
+					fmt.Fprintf(stderr, "Unknown command: %s", fullName(target, " ")+" "+name)
+					if s := suggest(name, names); s != "" {
+						fmt.Fprintf(stderr, ", did you mean %q?", s)
+					}
+					fmt.Fprintf(stderr, "\nRun '%s help' for a list of commands.\n", root.Name)
+					return target.argErrorExitCode()
+				}
+				target = next
+			}
+			stdout, _ := target.output()
+			if err := target.WriteUsage(stdout); err != nil {
+				panic(err)
+			}
+			return 0
+		})
+}
@@ -1,11 +1,20 @@
 package xflags
 
 import (
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestSubcommands(t *testing.T) {
@@ -119,6 +128,10 @@ func TestPosFlagOrdering(t *testing.T) {
 			String(&sink, "one", "", "").Positional().NArgs(1, 0),
 			String(&sink, "two", "", "").Positional(),
 		),
+		getFixture(
+			String(&sink, "file", "", "").Positional(),
+			String(&sink, "file", "", "").Positional(),
+		),
 	}
 	for i, builder := range errorCases {
 		t.Run(fmt.Sprintf("ErrorCase%02d", i+1), func(t *testing.T) {
@@ -129,6 +142,20 @@ func TestPosFlagOrdering(t *testing.T) {
 	}
 }
 
+func TestDuplicatePositionals(t *testing.T) {
+	var a, b string
+	_, err := NewCommand("test", "").
+		Flags(
+			String(&a, "file", "", "").Positional(),
+			String(&b, "file", "", "").Positional(),
+		).
+		Command()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	assertString(t, "xflags: test: positional argument already declared: FILE", err.Error())
+}
+
 func TestPositionalFlags(t *testing.T) {
 	var foo, bar string
 	var baz, qux []string
@@ -172,6 +199,85 @@ func TestFlagSet(t *testing.T) {
 	assertBool(t, true, qux)
 }
 
+func TestToFlagSet(t *testing.T) {
+	var name, region string
+	var verbose bool
+	var n int
+	cmd := NewCommand("app", "").
+		Flags(
+			Bool(&verbose, "verbose", false, "Print verbose output").ShortName("v"),
+			String(&region, "region", "us-east-1", "Region"),
+		).
+		Subcommands(
+			NewCommand("deploy", "").
+				Flags(
+					String(&name, "name", "", "App name").Positional(),
+					Int(&n, "n", 1, "Replicas"),
+				),
+		).
+		Must()
+	fs := cmd.Subcommands[0].ToFlagSet()
+	names := make([]string, 0)
+	fs.VisitAll(func(f *flag.Flag) { names = append(names, f.Name) })
+	assertStrings(t, []string{"n", "region", "verbose"}, names)
+	assertString(t, "us-east-1", fs.Lookup("region").DefValue)
+
+	err := fs.Parse([]string{"-verbose", "-region=eu-west-1", "-n", "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBool(t, true, verbose)
+	assertString(t, "eu-west-1", region)
+	assertInt64(t, 3, int64(n))
+
+	// import the exported flags back into a new command
+	imported := NewCommand("imported", "").FlagSet(fs).Must()
+	if _, err := imported.Parse([]string{"--region=ap-south-1", "-n=5"}); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "ap-south-1", region)
+	assertInt64(t, 5, int64(n))
+
+	// PrintDefaults calls String on the zero value of each Value type
+	var (
+		tags      []string
+		labels    map[string]string
+		ports     []int
+		intervals []time.Duration
+		since     time.Time
+		endpoint  *url.URL
+		bits      uint64
+		size      int64
+		small     int32
+		force     bool
+		reason    string
+	)
+	cmd = NewCommand("app", "").
+		Flags(
+			Strings(&tags, "tag", []string{"a"}, "Tags"),
+			StringMap(&labels, "label", "Labels"),
+			Ints(&ports, "port", nil, "Ports"),
+			Durations(&intervals, "interval", nil, "Intervals"),
+			Time(&since, "since", time.Time{}, "", "Since"),
+			URL(&endpoint, "endpoint", nil, "Endpoint"),
+			BitField(&bits, 0x1, "bit", false, "Bit"),
+			Quantity(&size, "size", "Size"),
+			Int32(&small, "small", 0, "Small"),
+			ForceReason(&force, &reason, "force", "Force"),
+		).
+		Must()
+	w := &bytes.Buffer{}
+	fs = cmd.ToFlagSet()
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+	if strings.Contains(w.String(), "panic") {
+		t.Errorf("unexpected panic in PrintDefaults:\n%s", w)
+	}
+	if !strings.Contains(w.String(), "Tags (default [a])") {
+		t.Errorf("expected default of --tag, got:\n%s", w)
+	}
+}
+
 func TestCommandLineage(t *testing.T) {
 	a, b, c := NewCommand("a", ""), NewCommand("b", ""), NewCommand("c", "")
 	a.Subcommands(b)
@@ -347,3 +453,996 @@ func ExampleCommandBuilder_WithTerminator() {
 	// + /bin/echo Hello, World!
 	// Hello, World!
 }
+
+func TestUsagePrefixInheritance(t *testing.T) {
+	cmd := NewCommand("app", "").
+		UsagePrefix("Uso:").
+		Subcommands(NewCommand("sub", "")).
+		Must()
+	w := &bytes.Buffer{}
+	if err := cmd.Subcommands[0].WriteUsage(w); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "Uso: app sub\n", w.String())
+}
+
+func ExampleCommandBuilder_UsagePrefix() {
+	cmd := NewCommand("helloworld", "Saluda al mundo").
+		UsagePrefix("Uso:")
+
+	// Print the help page
+	RunWithArgs(cmd, "--help")
+	// Output:
+	// Uso: helloworld
+	//
+	// Saluda al mundo
+}
+
+func TestUsageLine(t *testing.T) {
+	var verbose bool
+	var src, dst string
+	cmd := NewCommand("cp", "Copy files").
+		UsageLine("cp [OPTIONS] SOURCE DEST").
+		UsageLine("cp [OPTIONS] SOURCE... DIRECTORY").
+		Flags(
+			Bool(&verbose, "verbose", false, "Explain what is being done"),
+			String(&src, "source", "", "Source file").Positional(),
+			String(&dst, "dest", "", "Destination file").Positional(),
+		).
+		UsageLineFunc(func(cmd *Command) string { return "ignored" }).
+		Must()
+	w := &bytes.Buffer{}
+	if err := Format(w, cmd); err != nil {
+		t.Fatal(err)
+	}
+	expect := `Usage: cp [OPTIONS] SOURCE DEST
+       cp [OPTIONS] SOURCE... DIRECTORY
+
+Copy files
+
+Positional arguments:
+  SOURCE  Source file
+  DEST    Destination file
+
+Options:
+   --verbose  Explain what is being done
+`
+	assertString(t, expect, w.String())
+}
+
+func ExampleCommandBuilder_UsageLineFunc() {
+	var n int
+	cmd := NewCommand("helloworld", "Say \"Hello, World!\"").
+		Flags(Int(&n, "n", 1, "Print n times")).
+		UsageLineFunc(func(cmd *Command) string {
+			return fmt.Sprintf("usage: %s [-n count]", cmd.Name)
+		})
+
+	// Print the help page
+	RunWithArgs(cmd, "--help")
+	// Output:
+	// usage: helloworld [-n count]
+	//
+	// Say "Hello, World!"
+	//
+	// Options:
+	//   -n   Print n times
+}
+
+func ExampleCommand_PrintDefaults() {
+	var verbose, force bool
+	var name string
+	cmd := NewCommand("widgets", "Manage widgets").
+		Flags(Bool(&verbose, "verbose", false, "Print verbose output").ShortName("v")).
+		Subcommands(
+			NewCommand("create", "Create a widget").
+				Flags(
+					String(&name, "name", "", "Widget name").Positional(),
+					Bool(&force, "force", false, "Overwrite existing widgets"),
+				),
+		).
+		Must()
+
+	cmd.Subcommands[0].PrintDefaults(os.Stdout)
+	// Output:
+	// Options:
+	//    --force  Overwrite existing widgets
+	//
+	// Global options:
+	//   -v, --verbose  Print verbose output
+}
+
+func TestInheritedFlags(t *testing.T) {
+	var a, b, c, d bool
+	cmd := NewCommand("root", "").
+		Flags(
+			Bool(&a, "a", false, ""),
+			Bool(&b, "b", false, ""),
+		).
+		Subcommands(
+			NewCommand("child", "").
+				Flags(Bool(&c, "b", false, "")).
+				Subcommands(
+					NewCommand("grandchild", "").
+						Flags(Bool(&d, "d", false, "")),
+				),
+		).
+		Must()
+	assertFlagNames := func(expect []string, flags []*Flag) {
+		t.Helper()
+		actual := make([]string, len(flags))
+		for i, flag := range flags {
+			actual[i] = flag.String()
+		}
+		assertStrings(t, expect, actual)
+	}
+	child := cmd.Subcommands[0]
+	grandchild := child.Subcommands[0]
+	assertFlagNames([]string{}, cmd.InheritedFlags())
+	assertFlagNames([]string{"-a"}, child.InheritedFlags())
+	assertFlagNames([]string{"-b", "-a"}, grandchild.InheritedFlags())
+	if grandchild.InheritedFlags()[0] != child.FlagGroups[0].Flags[0] {
+		t.Errorf("expected -b to be inherited from the nearest ancestor")
+	}
+}
+
+func TestPersistentFlags(t *testing.T) {
+	var verbose, force bool
+	cmd := NewCommand("app", "").
+		PersistentFlags(Bool(&verbose, "verbose", false, "Print verbose output")).
+		Subcommands(
+			NewCommand("remote", "").
+				Subcommands(
+					NewCommand("add", "Add a remote").
+						Flags(Bool(&force, "force", false, "Overwrite")),
+				),
+		).
+		Must()
+	add, err := cmd.Parse([]string{"remote", "add", "--force", "--verbose"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "add", add.Name)
+	assertBool(t, true, verbose)
+	assertBool(t, true, force)
+
+	w := &bytes.Buffer{}
+	if err := add.WriteUsage(w); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, `Usage: app remote add [OPTIONS]
+
+Add a remote
+
+Options:
+   --force  Overwrite
+
+Global options:
+   --verbose  Print verbose output
+`, w.String())
+}
+
+func TestPersistentFlagsNArgs(t *testing.T) {
+	var name string
+	newCommand := func() *Command {
+		return NewCommand("app", "").
+			PersistentFlags(String(&name, "name", "", "").Required()).
+			Subcommands(NewCommand("create", "")).
+			Must()
+	}
+	_, err := newCommand().Parse([]string{"create"})
+	var argErr *ArgumentError
+	if assertErrorAs(t, err, &argErr) {
+		assertString(t, "--name: missing argument", argErr.String())
+	}
+
+	_, err = newCommand().Parse([]string{"--name", "a", "create", "--name", "b"})
+	if assertErrorAs(t, err, &argErr) {
+		assertString(t, "--name: expected 1 argument, got 2", argErr.String())
+	}
+
+	create, err := newCommand().Parse([]string{"create", "--name", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "create", create.Name)
+	assertString(t, "a", name)
+}
+
+func ExampleCommand_InheritedFlags() {
+	var verbose bool
+	var n int
+
+	cmd := NewCommand("widgets", "").
+		Flags(Bool(&verbose, "verbose", false, "Print verbose output")).
+		Subcommands(
+			NewCommand("create", "Make new widgets").
+				Flags(Int(&n, "n", 1, "Create n widgets")),
+		)
+
+	// Print the help page for the "create" subcommand
+	RunWithArgs(cmd, "create", "--help")
+	// Output:
+	// Usage: widgets create [OPTIONS]
+	//
+	// Make new widgets
+	//
+	// Options:
+	//   -n   Create n widgets
+	//
+	// Global options:
+	//    --verbose  Print verbose output
+}
+
+func TestVersion(t *testing.T) {
+	var verbose bool
+	var release string
+	newCommand := func(w io.Writer) *Command {
+		return NewCommand("app", "").
+			Output(w, w).
+			Version("v1.2.3").
+			Flags(Bool(&verbose, "verbose", false, "")).
+			Subcommands(
+				NewCommand("get", ""),
+				NewCommand("plugin", "").Version("v0.1.0"),
+				NewCommand("release", "").
+					Flags(String(&release, "version", "", "")),
+			).
+			Must()
+	}
+	tests := []struct {
+		args   []string
+		expect string
+	}{
+		{[]string{"--version"}, "v1.2.3\n"},
+		{[]string{"-V"}, "v1.2.3\n"},
+		{[]string{"get", "--version"}, "v1.2.3\n"},
+		{[]string{"plugin", "-V"}, "v0.1.0\n"},
+
+		// remaining arguments are not parsed
+		{[]string{"--version", "--foo", "nope"}, "v1.2.3\n"},
+	}
+	for _, test := range tests {
+		w := &bytes.Buffer{}
+		if code := newCommand(w).Run(test.args); code != 0 {
+			t.Errorf("%q: expected exit code 0, got %d", test.args, code)
+		}
+		assertString(t, test.expect, w.String())
+	}
+
+	// a declared flag takes precedence
+	target, err := newCommand(ioutil.Discard).Parse([]string{"release", "--version", "v2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "release", target.Name)
+	assertString(t, "v2", release)
+
+	// no version
+	_, err = NewCommand("app", "").Must().Parse([]string{"--version"})
+	assertErrorAs(t, err, new(*ArgumentError))
+}
+
+func TestVersionExits(t *testing.T) {
+	for _, exits := range []bool{true, false} {
+		t.Run(fmt.Sprintf("%v", exits), func(t *testing.T) {
+			ran := false
+			w := &bytes.Buffer{}
+			cmd := NewCommand("test", "").
+				Version("v1.2.3").
+				VersionExits(exits).
+				Output(w, w).
+				HandleFunc(func(args []string) int {
+					ran = true
+					return 0
+				}).
+				Must()
+			if code := cmd.Run([]string{"--version"}); code != 0 {
+				t.Errorf("expected exit code 0, got %d", code)
+			}
+			assertString(t, "v1.2.3\n", w.String())
+			assertBool(t, !exits, ran)
+		})
+	}
+}
+
+func TestOutput(t *testing.T) {
+	newCommand := func(stdout, stderr io.Writer) *Command {
+		return NewCommand("test", "Test command").
+			Output(stdout, stderr).
+			Version("v1.2.3").
+			Subcommands(
+				NewCommand("sub", "").
+					HandleFunc(func(args []string) int {
+						return 0
+					}),
+			).
+			Must()
+	}
+	tests := []struct {
+		args       []string
+		code       int
+		wantStdout bool
+		wantStderr bool
+	}{
+		{[]string{"--help"}, 0, true, false},
+		{[]string{"sub", "--help"}, 0, true, false},
+		{[]string{"--version"}, 0, true, false},
+		{[]string{"--foo"}, 1, false, true},
+		{[]string{"sub", "--foo"}, 1, false, true},
+	}
+	for _, test := range tests {
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		if code := newCommand(stdout, stderr).Run(test.args); code != test.code {
+			t.Errorf("%q: expected exit code %d, got %d", test.args, test.code, code)
+		}
+		assertBool(t, test.wantStdout, stdout.Len() > 0)
+		assertBool(t, test.wantStderr, stderr.Len() > 0)
+	}
+
+	// a nil writer is inherited or defaults to the OS
+	stdout := &bytes.Buffer{}
+	cmd := NewCommand("test", "").
+		Output(stdout, nil).
+		Subcommands(NewCommand("sub", "").Output(nil, ioutil.Discard)).
+		Must()
+	out, errOut := cmd.Subcommands[0].output()
+	if out != stdout {
+		t.Errorf("expected stdout to be inherited")
+	}
+	if errOut != ioutil.Discard {
+		t.Errorf("expected stderr to be set")
+	}
+	if _, errOut := cmd.output(); errOut != os.Stderr {
+		t.Errorf("expected stderr to default to os.Stderr")
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	newCommand := func() *Command {
+		return NewCommand("test", "").
+			Output(ioutil.Discard, ioutil.Discard).
+			ExitCodes(2, 3).
+			Subcommands(
+				NewCommand("sub", "").
+					HandleFunc(func(args []string) int {
+						return 0
+					}),
+				NewCommand("empty", ""),
+			).
+			Must()
+	}
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{[]string{"sub"}, 0},
+		{[]string{"--foo"}, 3},
+		{[]string{"sub", "--foo"}, 3},
+		{[]string{"nope"}, 3},
+		{[]string{"empty"}, 2},
+		{[]string{"help", "nope"}, 3},
+		{[]string{"--help"}, 0},
+	}
+	for _, test := range tests {
+		if code := newCommand().Run(test.args); code != test.code {
+			t.Errorf("%q: expected exit code %d, got %d", test.args, test.code, code)
+		}
+	}
+
+	// defaults
+	cmd := NewCommand("test", "").Output(ioutil.Discard, ioutil.Discard).Must()
+	if code := cmd.Run([]string{"--foo"}); code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+}
+
+func TestUsageOnError(t *testing.T) {
+	var name string
+	var n int
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd := NewCommand("widgets", "").
+		Output(stdout, stderr).
+		UsageOnError().
+		ExitCodes(2, 2).
+		Subcommands(
+			NewCommand("create", "Make new widgets").
+				Flags(
+					String(&name, "name", "", "Widget name").Required(),
+					Int(&n, "n", 1, "Number of widgets"),
+				).
+				HandleFunc(func(args []string) int {
+					return 0
+				}),
+		).
+		Must()
+	for _, args := range [][]string{
+		{"create", "-n", "3"},
+		{"create", "--name=foo", "--bar"},
+	} {
+		if code := cmd.Run(args); code != 2 {
+			t.Errorf("%q: expected exit code 2, got %d", args, code)
+		}
+	}
+	assertString(t, "", stdout.String())
+	assertGolden(t, "usage-on-error.txt", stderr.Bytes())
+}
+
+func TestSilence(t *testing.T) {
+	t.Run("Usage", func(t *testing.T) {
+		w := &bytes.Buffer{}
+		cmd := NewCommand("test", "").
+			Output(w, w).
+			SilenceUsage().
+			Subcommands(NewCommand("sub", "")).
+			Must()
+		if code := cmd.Run([]string{"sub"}); code == 0 {
+			t.Errorf("expected non-zero exit code")
+		}
+		assertString(t, "", w.String())
+	})
+	t.Run("Errors", func(t *testing.T) {
+		w := &bytes.Buffer{}
+		cmd := NewCommand("test", "").
+			Output(w, w).
+			SilenceErrors().
+			Subcommands(NewCommand("sub", "")).
+			Must()
+		for _, args := range [][]string{{"--foo"}, {"sub", "--foo"}} {
+			if code := cmd.Run(args); code == 0 {
+				t.Errorf("expected non-zero exit code")
+			}
+			assertString(t, "", w.String())
+		}
+	})
+}
+
+func TestArgsValidator(t *testing.T) {
+	testCases := []struct {
+		validator ArgsValidator
+		args      []string
+		ok        bool
+	}{
+		{ExactArgs(2), []string{"a", "b"}, true},
+		{ExactArgs(2), []string{"a"}, false},
+		{ExactArgs(2), []string{"a", "b", "c"}, false},
+		{MinimumNArgs(1), []string{"a"}, true},
+		{MinimumNArgs(1), []string{}, false},
+		{MaximumNArgs(1), []string{}, true},
+		{MaximumNArgs(1), []string{"a", "b"}, false},
+		{RangeArgs(1, 2), []string{"a", "b"}, true},
+		{RangeArgs(1, 2), []string{}, false},
+		{RangeArgs(1, 2), []string{"a", "b", "c"}, false},
+		{ExactArgs(2), []string{"a", "--", "b"}, true},
+	}
+	for i, testCase := range testCases {
+		t.Run(fmt.Sprintf("Case%02d", i+1), func(t *testing.T) {
+			var foo bool
+			cmd := NewCommand("test", "").
+				Flags(Bool(&foo, "foo", false, "")).
+				WithTerminator().
+				ArgsValidator(testCase.validator).
+				Must()
+			args := append([]string{"--foo"}, testCase.args...)
+			_, err := cmd.Parse(args)
+			if testCase.ok {
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			assertErrorAs(t, err, new(*ArgumentError))
+		})
+	}
+}
+
+func TestArgsValidatorArgs(t *testing.T) {
+	var foo string
+	var actual []string
+	cmd := NewCommand("test", "").
+		Flags(String(&foo, "foo", "", "").Positional()).
+		ArgsValidator(MinimumNArgs(1)).
+		HandleFunc(func(args []string) int {
+			actual = args
+			return 0
+		}).
+		Must()
+	if code := cmd.Run([]string{"one", "two", "three"}); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	assertString(t, "one", foo)
+	assertStrings(t, []string{"two", "three"}, actual)
+}
+
+// exitCode is panicked by a fake exit function in tests.
+type exitCode int
+
+func TestErrorHandling(t *testing.T) {
+	defer func(fn func(int)) { exit = fn }(exit)
+	exit = func(code int) { panic(exitCode(code)) }
+
+	// parse calls Parse and recovers any panic.
+	parse := func(mode ErrorHandling, args ...string) (err error, recovered interface{}) {
+		defer func() { recovered = recover() }()
+		w := &bytes.Buffer{}
+		_, err = NewCommand("test", "").
+			Output(w, w).
+			Version("1.0.0").
+			ErrorHandling(mode).
+			Must().
+			Parse(args)
+		return
+	}
+
+	err, recovered := parse(ContinueOnError, "--foo")
+	assertErrorAs(t, err, new(*ArgumentError))
+	if recovered != nil {
+		t.Errorf("expected no panic, got: %v", recovered)
+	}
+
+	_, recovered = parse(ExitOnError, "--foo")
+	if recovered != exitCode(2) {
+		t.Errorf("expected exit code 2, got: %v", recovered)
+	}
+
+	// the exit code of argument errors is configurable
+	func() {
+		defer func() { recovered = recover() }()
+		NewCommand("test", "").
+			Output(ioutil.Discard, ioutil.Discard).
+			ExitCodes(2, 3).
+			ErrorHandling(ExitOnError).
+			Must().
+			Parse([]string{"--foo"})
+	}()
+	if recovered != exitCode(3) {
+		t.Errorf("expected exit code 3, got: %v", recovered)
+	}
+
+	for _, arg := range []string{"--help", "-h", "--version"} {
+		_, recovered = parse(ExitOnError, arg)
+		if recovered != exitCode(0) {
+			t.Errorf("%s: expected exit code 0, got: %v", arg, recovered)
+		}
+	}
+
+	_, recovered = parse(PanicOnError, "--foo")
+	if err, ok := recovered.(error); !ok {
+		t.Errorf("expected panic with error, got: %v", recovered)
+	} else {
+		assertErrorAs(t, err, new(*ArgumentError))
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	type contextKey struct{}
+	var actual interface{}
+	cmd := NewCommand("test", "").
+		Subcommands(
+			NewCommand("foo", "").
+				Subcommands(
+					NewCommand("bar", "").
+						HandleFuncC(func(ctx context.Context, args []string) int {
+							actual = ctx.Value(contextKey{})
+							return 0
+						}),
+				),
+		).
+		Must()
+	ctx := context.WithValue(context.Background(), contextKey{}, "baz")
+	if code := cmd.RunContext(ctx, []string{"foo", "bar"}); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	if actual != "baz" {
+		t.Errorf("expected context value \"baz\", got: %v", actual)
+	}
+}
+
+func TestChanged(t *testing.T) {
+	var verbose bool
+	var n int
+	var region, name string
+	newCommand := func() *Command {
+		return NewCommand("app", "").
+			Flags(
+				Bool(&verbose, "verbose", false, "").ShortName("v"),
+				Int(&n, "n", 5, ""),
+				String(&region, "region", "", "").Env("TEST_REGION"),
+				String(&name, "name", "", "").Default("foo"),
+			).
+			Must()
+	}
+
+	cmd := newCommand()
+	_, err := cmd.ParseWithEnv(
+		[]string{"--verbose=false", "-n", "5"},
+		map[string]string{"TEST_REGION": "us-east-1"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expect := range map[string]bool{
+		"verbose": true, // set to its zero value
+		"v":       true,
+		"n":       true, // set to its default
+		"region":  true, // set by env
+		"name":    false,
+		"missing": false,
+	} {
+		assertBool(t, expect, cmd.Changed(name))
+	}
+
+	cmd = newCommand()
+	if _, err := cmd.ParseWithEnv(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"verbose", "n", "region", "name"} {
+		if cmd.Changed(name) {
+			t.Errorf("expected %s to be unchanged", name)
+		}
+	}
+}
+
+func TestLookupAndVisit(t *testing.T) {
+	var verbose, force bool
+	var name, region string
+	cmd := NewCommand("app", "").
+		Flags(
+			Bool(&verbose, "verbose", false, "").ShortName("v"),
+			String(&region, "region", "", "").Env("TEST_REGION"),
+		).
+		Subcommands(
+			NewCommand("deploy", "").
+				Flags(
+					String(&name, "name", "", "").Aliases("app-name"),
+					Bool(&force, "force", false, ""),
+				),
+		).
+		Must()
+	deploy := cmd.Subcommands[0]
+
+	for name, expect := range map[string]*Flag{
+		"name":     deploy.FlagGroups[0].Flags[0],
+		"app-name": deploy.FlagGroups[0].Flags[0],
+		"v":        cmd.FlagGroups[0].Flags[0],
+		"verbose":  cmd.FlagGroups[0].Flags[0],
+		"missing":  nil,
+	} {
+		if actual := deploy.Lookup(name); actual != expect {
+			t.Errorf("Lookup(%q): expected %v, got %v", name, expect, actual)
+		}
+	}
+	if flag := cmd.Lookup("name"); flag != nil {
+		t.Errorf("expected parent command not to find flag of subcommand, got %v", flag)
+	}
+
+	_, err := cmd.ParseWithEnv(
+		[]string{"deploy", "--app-name", "foo", "-v"},
+		map[string]string{"TEST_REGION": "us-east-1"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := func(visit func(func(*Flag))) []string {
+		a := make([]string, 0)
+		visit(func(flag *Flag) { a = append(a, flag.Name) })
+		return a
+	}
+	assertStrings(t, []string{"name", "force", "verbose", "region"}, names(deploy.VisitAll))
+	assertStrings(t, []string{"name", "verbose", "region"}, names(deploy.Visit))
+	assertStrings(t, []string{"verbose", "region"}, names(cmd.Visit))
+}
+
+func TestReset(t *testing.T) {
+	var verbose bool
+	var n int
+	var tags []string
+	var labels map[string]string
+	cmd := NewCommand("app", "").
+		WithTerminator().
+		Flags(
+			Bool(&verbose, "verbose", false, ""),
+			Count(&n, "n", ""),
+		).
+		Subcommands(
+			NewCommand("tag", "").
+				WithTerminator().
+				Flags(
+					Strings(&tags, "tag", []string{"latest"}, ""),
+					StringMap(&labels, "label", ""),
+				),
+		).
+		Must()
+	tag := cmd.Subcommands[0]
+
+	args := []string{"--verbose", "-n", "-n", "tag", "--tag=v1", "--label=a=b", "--", "x"}
+	if _, err := cmd.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	assertBool(t, true, verbose)
+	assertInt64(t, 2, int64(n))
+	assertStrings(t, []string{"v1"}, tags)
+	assertStrings(t, []string{"x"}, tag.Args())
+
+	cmd.Reset()
+	assertBool(t, false, verbose)
+	assertInt64(t, 0, int64(n))
+	assertStrings(t, []string{"latest"}, tags)
+	if labels != nil {
+		t.Errorf("expected nil labels, got %v", labels)
+	}
+	assertStrings(t, []string{}, tag.Args())
+	tag.Visit(func(flag *Flag) { t.Errorf("unexpected visit after reset: %v", flag) })
+
+	if _, err := cmd.Parse([]string{"-n", "tag", "--tag=v2"}); err != nil {
+		t.Fatal(err)
+	}
+	assertBool(t, false, verbose)
+	assertInt64(t, 1, int64(n))
+	assertStrings(t, []string{"v2"}, tags)
+	if labels != nil {
+		t.Errorf("expected nil labels, got %v", labels)
+	}
+}
+
+func TestResetBitField(t *testing.T) {
+	var mode uint64 = 0444
+	cmd := NewCommand("chmod", "").
+		Flags(
+			BitField(&mode, 0400, "r", false, ""),
+			BitField(&mode, 0200, "w", false, ""),
+		).
+		Must()
+	if _, err := cmd.Parse([]string{"-w"}); err != nil {
+		t.Fatal(err)
+	}
+	assertUint64(t, 0644, mode)
+	cmd.Reset()
+	assertUint64(t, 0444, mode)
+}
+
+// syncValue is a Value that is safe for concurrent use.
+type syncValue struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (v *syncValue) Set(s string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.n++
+	return nil
+}
+
+func TestParseArgsConcurrent(t *testing.T) {
+	v := &syncValue{}
+	cmd := NewCommand("app", "").
+		Subcommands(
+			NewCommand("run", "").
+				WithTerminator().
+				Flags(Var(v, "v", "")),
+		).
+		Must()
+
+	const n = 16
+	var wg sync.WaitGroup
+	results := make([]*ParseResult, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = cmd.ParseArgs([]string{"run", "-v=1", "--", strconv.Itoa(i)})
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		r := results[i]
+		if r.Command != cmd.Subcommands[0] {
+			t.Errorf("expected command run, got %v", r.Command)
+		}
+		assertStrings(t, []string{strconv.Itoa(i)}, r.Args)
+		visited := 0
+		r.Visit(func(*Flag) { visited++ })
+		if visited != 1 {
+			t.Errorf("expected 1 flag visited, got %d", visited)
+		}
+	}
+	if v.n != n {
+		t.Errorf("expected %d calls to Set, got %d", n, v.n)
+	}
+	if args := cmd.Subcommands[0].Args(); args != nil {
+		t.Errorf("expected command args to be unmodified, got %v", args)
+	}
+}
+
+func TestCommandSet(t *testing.T) {
+	var n int
+	var s string
+	cmd := NewCommand("test", "").
+		Flags(
+			Int(&n, "number", 0, "").ShortName("n"),
+			String(&s, "color", "", "").Choices("red", "blue"),
+		).
+		Must()
+	if err := cmd.Set("n", "42"); err != nil {
+		t.Fatal(err)
+	}
+	assertInt64(t, 42, int64(n))
+	if err := cmd.Set("color", "blue"); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "blue", s)
+	assertErrorAs(t, cmd.Set("color", "green"), new(*ArgumentError))
+	assertString(t, "blue", s)
+	assertErrorAs(t, cmd.Set("number", "x"), new(*ArgumentError))
+	if err := cmd.Set("missing", "x"); err == nil {
+		t.Errorf("expected error for unknown flag")
+	}
+	visited := 0
+	cmd.Visit(func(*Flag) { visited++ })
+	assertInt64(t, 2, int64(visited))
+}
+
+func TestHelpAll(t *testing.T) {
+	var verbose, debug bool
+	w := &bytes.Buffer{}
+	cmd := NewCommand("app", "").
+		Output(w, w).
+		Flags(
+			Bool(&verbose, "verbose", false, "Verbose output"),
+			Bool(&debug, "debug", false, "Debug output").Hidden(),
+		).
+		Subcommands(
+			NewCommand("run", "Run the app"),
+			NewCommand("internal", "Internal tools").Hidden(),
+		).
+		Must()
+
+	if code := RunWithArgs(cmd, "--help"); code != 0 {
+		t.Errorf("expected exit code 0, got %d", code)
+	}
+	assertString(
+		t,
+		"Usage: app [OPTIONS] COMMAND\n\n"+
+			"Options:\n"+
+			"   --verbose  Verbose output\n\n"+
+			"Commands:\n"+
+			"  run  Run the app\n",
+		w.String(),
+	)
+
+	w.Reset()
+	if code := RunWithArgs(cmd, "--help-all"); code != 0 {
+		t.Errorf("expected exit code 0, got %d", code)
+	}
+	assertString(
+		t,
+		"Usage: app [OPTIONS] COMMAND\n\n"+
+			"Options:\n"+
+			"   --verbose  Verbose output\n"+
+			"   --debug    Debug output (hidden)\n\n"+
+			"Commands:\n"+
+			"  run       Run the app\n"+
+			"  internal  Internal tools (hidden)\n",
+		w.String(),
+	)
+	if !cmd.FlagGroups[0].Flags[1].Hidden || !cmd.Subcommands[1].Hidden {
+		t.Errorf("expected --help-all not to modify the command")
+	}
+}
+
+func TestHelpCommand(t *testing.T) {
+	w := &bytes.Buffer{}
+	cmd := NewCommand("app", "").
+		Output(w, w).
+		WithHelpCommand().
+		Subcommands(
+			NewCommand("create", "Create a widget").
+				Subcommands(NewCommand("widget", "")),
+		).
+		Must()
+	testCases := []struct {
+		args   []string
+		code   int
+		expect string
+	}{
+		{
+			[]string{"help"},
+			0,
+			"Usage: app COMMAND\n\n" +
+				"Commands:\n" +
+				"  create  Create a widget\n" +
+				"  help    Show help for a command\n",
+		},
+		{
+			[]string{"help", "create"},
+			0,
+			"Usage: app create COMMAND\n\n" +
+				"Create a widget\n\n" +
+				"Commands:\n" +
+				"  widget  \n",
+		},
+		{
+			[]string{"help", "create", "widget"},
+			0,
+			"Usage: app create widget\n",
+		},
+		{
+			[]string{"help", "creat"},
+			1,
+			"Unknown command: app creat, did you mean \"create\"?\n" +
+				"Run 'app help' for a list of commands.\n",
+		},
+		{
+			[]string{"help", "create", "bogus"},
+			1,
+			"Unknown command: app create bogus\n" +
+				"Run 'app help' for a list of commands.\n",
+		},
+	}
+	for _, testCase := range testCases {
+		w.Reset()
+		if code := RunWithArgs(cmd, testCase.args...); code != testCase.code {
+			t.Errorf("%q: expected exit code %d, got %d", testCase.args, testCase.code, code)
+		}
+		assertString(t, testCase.expect, w.String())
+	}
+}
+
+func TestDefaultSubcommand(t *testing.T) {
+	var verbose, all bool
+	var ran string
+	newCommand := func() *Command {
+		verbose, all, ran = false, false, ""
+		handler := func(name string) func([]string) int {
+			return func(args []string) int {
+				ran = name
+				return 0
+			}
+		}
+		return NewCommand("app", "").
+			DefaultSubcommand("status").
+			Flags(Bool(&verbose, "verbose", false, "")).
+			Subcommands(
+				NewCommand("status", "").
+					Flags(Bool(&all, "all", false, "")).
+					HandleFunc(handler("status")),
+				NewCommand("deploy", "").HandleFunc(handler("deploy")),
+			).
+			Must()
+	}
+	testCases := []struct {
+		args    []string
+		ran     string
+		verbose bool
+		all     bool
+	}{
+		{nil, "status", false, false},
+		{[]string{"--verbose"}, "status", true, false},
+		{[]string{"--verbose", "--all"}, "status", true, true},
+		{[]string{"--all", "--verbose"}, "status", true, true},
+		{[]string{"status", "--all"}, "status", false, true},
+		{[]string{"deploy", "--verbose"}, "deploy", true, false},
+	}
+	for _, testCase := range testCases {
+		if code := RunWithArgs(newCommand(), testCase.args...); code != 0 {
+			t.Errorf("%q: expected exit code 0, got %d", testCase.args, code)
+			continue
+		}
+		assertString(t, testCase.ran, ran)
+		assertBool(t, testCase.verbose, verbose)
+		assertBool(t, testCase.all, all)
+	}
+
+	_, err := NewCommand("app", "").
+		DefaultSubcommand("bogus").
+		Subcommands(NewCommand("status", "")).
+		Command()
+	if err == nil {
+		t.Errorf("expected error for unknown default subcommand")
+	}
+}
@@ -0,0 +1,324 @@
+package xflags
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// completeCommandName is the name of the hidden subcommand added by
+// CommandBuilder.WithCompletion.
+const completeCommandName = "__complete"
+
+// newCompleteCommand returns a builder for the hidden subcommand that prints
+// completion candidates for the given root command.
+func newCompleteCommand(root *Command) *CommandBuilder {
+	return NewCommand(completeCommandName, "Print completion candidates").
+		Hidden().
+		WithTerminator().
+		HandleFunc(func(args []string) int {
+			stdout, _ := root.output()
+			for _, s := range complete(root, args) {
+				fmt.Fprintln(stdout, s)
+			}
+			return 0
+		})
+}
+
+// WriteCompletion writes a shell completion script for this command and all of
+// its subcommands to w. The supported shells are "bash" and "zsh".
+//
+// The script completes subcommand names, flag names and the values of flags
+// that specify Choices. If the command was built with
+// CommandBuilder.WithCompletion, the script also calls back into the program to
+// complete the values of flags that specify a CompleteFunc. Hidden commands and
+// flags are not completed.
+func (c *Command) WriteCompletion(w io.Writer, shell string) error {
+	switch shell {
+	case "bash":
+		return writeBashCompletion(w, c)
+	case "zsh":
+		return writeZshCompletion(w, c)
+	}
+	return errorf("unsupported shell: %s", shell)
+}
+
+// complete returns the completion candidates for the last of the given words
+// which are the command line arguments given to cmd.
+func complete(cmd *Command, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	var valueFlag *Flag
+	for _, word := range words[:len(words)-1] {
+		if valueFlag != nil {
+			valueFlag = nil
+			continue
+		}
+		if isPositional(word) {
+			for _, sub := range cmd.Subcommands {
+				if sub.Name == word {
+					cmd = sub
+					break
+				}
+			}
+			continue
+		}
+		key, _, hasValue := splitArg(word)
+		for _, flag := range completionFlags(cmd) {
+			for _, k := range flag.keys() {
+				if k == key && !hasValue && !isBoolValue(flag.Value) && !flag.ValueOptional {
+					valueFlag = flag
+				}
+			}
+		}
+	}
+	cur := words[len(words)-1]
+	var candidates []string
+	if valueFlag != nil && valueFlag.CompleteFunc != nil {
+		candidates = valueFlag.CompleteFunc(cur)
+	} else if valueFlag != nil {
+		candidates = valueFlag.Choices
+	} else if strings.HasPrefix(cur, "-") {
+		candidates = completionFlagKeys(cmd)
+	} else {
+		candidates = completionSubcommands(cmd)
+	}
+	a := make([]string, 0, len(candidates))
+	for _, s := range candidates {
+		if strings.HasPrefix(s, cur) {
+			a = append(a, s)
+		}
+	}
+	return a
+}
+
+// completionFlags returns the regular flags that may be specified for cmd and
+// are not hidden.
+func completionFlags(cmd *Command) []*Flag {
+	a := make([]*Flag, 0, 8)
+	for _, group := range cmd.FlagGroups {
+		a = append(a, filterRegular(group.Flags)...)
+	}
+	return append(a, filterRegular(cmd.InheritedFlags())...)
+}
+
+func completionFlagKeys(cmd *Command) []string {
+	a := make([]string, 0, 8)
+	for _, flag := range completionFlags(cmd) {
+		a = append(a, flag.keys()...)
+		if flag.Negatable {
+			a = append(a, "--no-"+flag.Name)
+		}
+	}
+	return a
+}
+
+func completionSubcommands(cmd *Command) []string {
+	a := make([]string, 0, len(cmd.Subcommands))
+	for _, sub := range cmd.Subcommands {
+		if !sub.Hidden {
+			a = append(a, sub.Name)
+		}
+	}
+	return a
+}
+
+// completionCase is a case clause of a completion script which matches a
+// command path and optionally the preceding word. If dynamic is true, the
+// candidates are printed by the program's completion subcommand instead of
+// given as words.
+type completionCase struct {
+	pattern string
+	words   []string
+	dynamic bool
+}
+
+// hasCompleteCommand returns true if cmd has the completion subcommand added by
+// CommandBuilder.WithCompletion.
+func hasCompleteCommand(cmd *Command) bool {
+	for _, sub := range cmd.Subcommands {
+		if sub.Name == completeCommandName {
+			return true
+		}
+	}
+	return false
+}
+
+// completionCases walks the command tree and returns the case clauses to
+// complete each command and each flag value. If dynamic is true, the values of
+// flags with a CompleteFunc are completed by the program at runtime.
+func completionCases(cmd *Command, path string, dynamic bool) (commands, values []completionCase) {
+	commands = append(commands, completionCase{
+		pattern: path,
+		words:   append(completionSubcommands(cmd), completionFlagKeys(cmd)...),
+	})
+	for _, flag := range completionFlags(cmd) {
+		isDynamic := dynamic && flag.CompleteFunc != nil
+		if len(flag.Choices) == 0 && !isDynamic {
+			continue
+		}
+		for _, key := range flag.keys() {
+			values = append(values, completionCase{
+				pattern: path + " " + key,
+				words:   flag.Choices,
+				dynamic: isDynamic,
+			})
+		}
+	}
+	for _, sub := range cmd.Subcommands {
+		if sub.Hidden {
+			continue
+		}
+		c, v := completionCases(sub, path+" "+sub.Name, dynamic)
+		commands = append(commands, c...)
+		values = append(values, v...)
+	}
+	return
+}
+
+// completionPaths returns the quoted case patterns that match each subcommand
+// path.
+func completionPaths(commands []completionCase) string {
+	a := make([]string, 0, len(commands))
+	for _, c := range commands[1:] {
+		a = append(a, shellQuote(c.pattern))
+	}
+	sort.Strings(a)
+	return strings.Join(a, "|")
+}
+
+// completionName returns the name of a command as it is invoked from the shell
+// and the name of its completion function.
+func completionName(cmd *Command) (name, funcName string) {
+	name = filepath.Base(cmd.Name)
+	funcName = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' ||
+			r >= 'A' && r <= 'Z' ||
+			r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+	return name, "_" + funcName
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func writeBashCompletion(w io.Writer, cmd *Command) error {
+	aw := newAggregatedWriter(w)
+	name, funcName := completionName(cmd)
+	commands, values := completionCases(cmd, name, hasCompleteCommand(cmd))
+	fmt.Fprintf(aw, "# bash completion for %s\n\n", name)
+	fmt.Fprintf(aw, "%s() {\n", funcName)
+	fmt.Fprintf(aw, "    local cur prev cmdpath word i\n")
+	fmt.Fprintf(aw, "    cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	fmt.Fprintf(aw, "    prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	fmt.Fprintf(aw, "    cmdpath=%s\n", shellQuote(name))
+	if len(commands) > 1 {
+		fmt.Fprintf(aw, "    for ((i = 1; i < COMP_CWORD; i++)); do\n")
+		fmt.Fprintf(aw, "        word=\"${COMP_WORDS[i]}\"\n")
+		fmt.Fprintf(aw, "        case \"${cmdpath} ${word}\" in\n")
+		fmt.Fprintf(aw, "            %s) cmdpath=\"${cmdpath} ${word}\" ;;\n", completionPaths(commands))
+		fmt.Fprintf(aw, "        esac\n")
+		fmt.Fprintf(aw, "    done\n")
+	}
+	if len(values) > 0 {
+		fmt.Fprintf(aw, "    case \"${cmdpath} ${prev}\" in\n")
+		for _, c := range values {
+			if c.dynamic {
+				fmt.Fprintf(
+					aw,
+					"        %s) COMPREPLY=($(\"${COMP_WORDS[0]}\" %s -- \"${COMP_WORDS[@]:1:COMP_CWORD}\" 2>/dev/null)); return ;;\n",
+					shellQuote(c.pattern),
+					completeCommandName,
+				)
+				continue
+			}
+			fmt.Fprintf(
+				aw,
+				"        %s) COMPREPLY=($(compgen -W %s -- \"${cur}\")); return ;;\n",
+				shellQuote(c.pattern),
+				shellQuote(strings.Join(c.words, " ")),
+			)
+		}
+		fmt.Fprintf(aw, "    esac\n")
+	}
+	fmt.Fprintf(aw, "    case \"${cmdpath}\" in\n")
+	for _, c := range commands {
+		fmt.Fprintf(
+			aw,
+			"        %s) COMPREPLY=($(compgen -W %s -- \"${cur}\")) ;;\n",
+			shellQuote(c.pattern),
+			shellQuote(strings.Join(c.words, " ")),
+		)
+	}
+	fmt.Fprintf(aw, "    esac\n")
+	fmt.Fprintf(aw, "}\n\n")
+	fmt.Fprintf(aw, "complete -F %s %s\n", funcName, name)
+	return aw.Err()
+}
+
+func writeZshCompletion(w io.Writer, cmd *Command) error {
+	aw := newAggregatedWriter(w)
+	name, funcName := completionName(cmd)
+	commands, values := completionCases(cmd, name, hasCompleteCommand(cmd))
+	fmt.Fprintf(aw, "#compdef %s\n\n", name)
+	fmt.Fprintf(aw, "%s() {\n", funcName)
+	fmt.Fprintf(aw, "    local cmdpath word i\n")
+	fmt.Fprintf(aw, "    cmdpath=%s\n", shellQuote(name))
+	if len(commands) > 1 {
+		fmt.Fprintf(aw, "    for ((i = 2; i < CURRENT; i++)); do\n")
+		fmt.Fprintf(aw, "        word=\"${words[i]}\"\n")
+		fmt.Fprintf(aw, "        case \"${cmdpath} ${word}\" in\n")
+		fmt.Fprintf(aw, "            %s) cmdpath=\"${cmdpath} ${word}\" ;;\n", completionPaths(commands))
+		fmt.Fprintf(aw, "        esac\n")
+		fmt.Fprintf(aw, "    done\n")
+	}
+	if len(values) > 0 {
+		fmt.Fprintf(aw, "    case \"${cmdpath} ${words[CURRENT-1]}\" in\n")
+		for _, c := range values {
+			if c.dynamic {
+				fmt.Fprintf(
+					aw,
+					"        %s) compadd -- ${(f)\"$(\"${words[1]}\" %s -- \"${(@)words[2,CURRENT]}\" 2>/dev/null)\"}; return ;;\n",
+					shellQuote(c.pattern),
+					completeCommandName,
+				)
+				continue
+			}
+			fmt.Fprintf(
+				aw,
+				"        %s) compadd -- %s; return ;;\n",
+				shellQuote(c.pattern),
+				quoteWords(c.words),
+			)
+		}
+		fmt.Fprintf(aw, "    esac\n")
+	}
+	fmt.Fprintf(aw, "    case \"${cmdpath}\" in\n")
+	for _, c := range commands {
+		fmt.Fprintf(
+			aw,
+			"        %s) compadd -- %s ;;\n",
+			shellQuote(c.pattern),
+			quoteWords(c.words),
+		)
+	}
+	fmt.Fprintf(aw, "    esac\n")
+	fmt.Fprintf(aw, "}\n\n")
+	fmt.Fprintf(aw, "compdef %s %s\n", funcName, name)
+	return aw.Err()
+}
+
+func quoteWords(words []string) string {
+	a := make([]string, len(words))
+	for i, word := range words {
+		a[i] = shellQuote(word)
+	}
+	return strings.Join(a, " ")
+}
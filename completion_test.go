@@ -0,0 +1,58 @@
+package xflags
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestWriteCompletion(t *testing.T) {
+	cmd := newWidgetsCommand(nil)
+	for _, shell := range []string{"bash", "zsh"} {
+		w := &bytes.Buffer{}
+		if err := cmd.WriteCompletion(w, shell); err != nil {
+			t.Fatal(err)
+		}
+		assertGolden(t, "completion."+shell, w.Bytes())
+	}
+	if err := cmd.WriteCompletion(ioutil.Discard, "tcsh"); err == nil {
+		t.Errorf("expected error for unsupported shell")
+	}
+}
+
+func TestComplete(t *testing.T) {
+	testCases := []struct {
+		args   []string
+		expect []string
+	}{
+		{[]string{""}, []string{"create", "destroy"}},
+		{[]string{"c"}, []string{"create"}},
+		{[]string{"--"}, []string{"--verbose", "--color"}},
+		{[]string{"-"}, []string{"--verbose", "-v", "--color"}},
+		{[]string{"--color", ""}, []string{"auto", "always", "never"}},
+		{[]string{"--color", "a"}, []string{"auto", "always"}},
+		{[]string{"--color=never", ""}, []string{"create", "destroy"}},
+		{[]string{"-v", "create", "-"}, []string{"-n", "--format", "--name", "--verbose", "-v", "--color"}},
+		{[]string{"create", "--format", "j"}, []string{"json"}},
+		{[]string{"create", "--name", ""}, []string{"gadget", "gizmo", "widget"}},
+		{[]string{"create", "--name", "g"}, []string{"gadget", "gizmo"}},
+		{[]string{"create", "--name", "gi"}, []string{"gizmo"}},
+		{[]string{"create", "-n", ""}, []string{}},
+	}
+	for _, testCase := range testCases {
+		w := &bytes.Buffer{}
+		cmd := newWidgetsCommand(w)
+		args := append([]string{completeCommandName, "--"}, testCase.args...)
+		if code := cmd.Run(args); code != 0 {
+			t.Errorf("%q: expected exit code 0, got %d", testCase.args, code)
+			continue
+		}
+		actual := make([]string, 0)
+		for _, line := range bytes.Split(w.Bytes(), []byte("\n")) {
+			if len(line) > 0 {
+				actual = append(actual, string(line))
+			}
+		}
+		assertStrings(t, testCase.expect, actual)
+	}
+}
@@ -7,7 +7,9 @@ Package xflags aims to make composing large, full-featured command line tools as
 possible. The Builder pattern is employed with method chaining to configure commands and flags
 declaratively with error checking.
 
-For compatibility, flag.FlagSets may be imported with CommandBuilder.FlagSet.
+For compatibility, flag.FlagSets may be imported with CommandBuilder.FlagSet and
+github.com/spf13/pflag FlagSets may be imported with the pflagset module,
+github.com/cavaliergopher/xflags/pflagset, which has its own go.mod.
 
 Usage
 
@@ -55,8 +57,9 @@ A handler may be defined for your command by
 		return 0
 	}
 
-Flag parsing will stop after "--" only if a command sets WithTerminator. All arguments following the
-terminator will be passed to the command handler.
+Flag parsing will stop after "--" only if a command or one of its ancestors sets WithTerminator. All
+arguments following the terminator will be passed to the handler of the command that was selected
+when the terminator was reached.
 
 You can define subcommands by
 
@@ -86,15 +89,27 @@ In addition to positional arguments, the following forms are permitted:
 
 	-f
 	-f=x
+	-fx // non-boolean flags only
 	-f x // non-boolean flags only
+	-abc // boolean short flags, equivalent to -a -b -c
 	--flag
 	--flag=x
 	--flag x // non-boolean flags only
 
-The noted forms are not permitted for boolean flags because of the meaning of the command
+Boolean flags accept the values 1, t, T, TRUE, true, True, 0, f, F, FALSE, false
+and False. The noted forms are not permitted for boolean flags because of the meaning of the command
 
 	cmd -x *
 
 where * is a Unix shell wildcard, will change if there is a file called 0, false, etc.
+
+A value that starts with "-", other than a negative number, must be given with "=" as in
+--prefix=-foo or -p=-foo, as --prefix -foo is parsed as two flags.
+
+An empty value, as in --flag= or -f=, is only permitted for flags that accept
+one, such as string flags. For all other flags it is an error.
+
+Integer flags accept decimal values or, with a 0x, 0o or 0b prefix, hexadecimal, octal or binary
+values. E.g. --mode=0o755. A leading zero alone does not indicate octal.
 */
 package xflags
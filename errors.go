@@ -3,8 +3,14 @@ package xflags
 import (
 	"bytes"
 	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
+// redacted replaces the value of sensitive flags in error messages.
+const redacted = "****"
+
 type xflagsErr struct {
 	Text string
 	Err  error
@@ -32,24 +38,58 @@ func errorf(format string, a ...interface{}) error {
 	return &xflagsErr{Text: fmt.Sprintf(format, a...)}
 }
 
-// HelpError is the error returned if the -h or --help argument is specified
-// but no such flag is explicitly defined.
+// HelpError is the error returned if the -h, --help or --help-all argument is
+// specified but no such flag is explicitly defined.
 type HelpError struct {
-	Cmd *Command // The command that was invoked and produced this error.
+	Cmd        *Command // The command that was invoked and produced this error.
+	ShowHidden bool     // True if hidden flags and commands were requested.
 }
 
 func (err *HelpError) Error() string {
 	return fmt.Sprintf("xflags: help requested: %s", err.Cmd)
 }
 
+// VersionError is the error returned if the --version argument is specified
+// for a command with a version string that exits after printing it.
+type VersionError struct {
+	Cmd *Command // The command that was invoked and produced this error.
+}
+
+func (err *VersionError) Error() string {
+	return fmt.Sprintf("xflags: version requested: %s", err.Cmd)
+}
+
+// UnknownFlagError is the error wrapped by an ArgumentError when a flag
+// specified on the command line is not defined by the command or any of its
+// ancestors.
+type UnknownFlagError struct {
+	Cmd        *Command // The command that was being parsed.
+	Arg        string   // The flag name as specified on the command line.
+	Suggestion string   // The most similar flag name, if one is likely intended.
+}
+
+func (e *UnknownFlagError) Error() string { return "xflags: " + e.String() }
+
+func (e *UnknownFlagError) String() string {
+	if e.Suggestion != "" {
+		return fmt.Sprintf("unrecognized argument: %s, did you mean %q?", e.Arg, e.Suggestion)
+	}
+	return fmt.Sprintf("unrecognized argument: %s", e.Arg)
+}
+
 // ArgumentError indicates that an argument specified on the command line was
 // incorrect.
+//
+// If Flag is sensitive, Arg is redacted, as is the original argument wherever
+// it appears as a whole word in the message of Err.
 type ArgumentError struct {
 	Text string
 	Err  error
 	Cmd  *Command
 	Flag *Flag
 	Arg  string
+
+	secret string
 }
 
 func (e *ArgumentError) Unwrap() error { return e.Err }
@@ -58,9 +98,6 @@ func (e *ArgumentError) Error() string { return "xflags: " + e.String() }
 
 func (e *ArgumentError) String() string {
 	w := new(bytes.Buffer)
-	if e.Flag != nil {
-		fmt.Fprintf(w, "%s: ", e.Flag)
-	}
 	if e.Text != "" {
 		fmt.Fprintf(w, e.Text)
 	}
@@ -68,9 +105,13 @@ func (e *ArgumentError) String() string {
 		fmt.Fprintf(w, ": ")
 	}
 	if e.Err != nil {
-		fmt.Fprintf(w, "%s", errStr(e.Err))
+		fmt.Fprintf(w, "%s", redactWord(errStr(e.Err), e.secret))
 	}
-	return w.String()
+	s := w.String()
+	if e.Flag != nil {
+		s = fmt.Sprintf("%s: %s", e.Flag, s)
+	}
+	return s
 }
 
 func newArgErr(
@@ -83,18 +124,60 @@ func newArgErr(
 	if cmd == nil {
 		panic("developer error: cmd cannot be nil")
 	}
-	e := wrapArgErr(nil, cmd, flag, arg)
-	e.Text = fmt.Sprintf(format, a...)
-	return e
+	return &ArgumentError{
+		Text: fmt.Sprintf(format, a...),
+		Cmd:  cmd,
+		Flag: flag,
+		Arg:  arg,
+	}
 }
 
 func wrapArgErr(err error, cmd *Command, flag *Flag, arg string) *ArgumentError {
-	return &ArgumentError{
+	e := &ArgumentError{
 		Err:  err,
 		Cmd:  cmd,
 		Flag: flag,
 		Arg:  arg,
 	}
+	if flag != nil && flag.Sensitive && arg != "" {
+		e.Arg = redacted
+		e.secret = arg
+	}
+	return e
+}
+
+// redactWord replaces each occurrence of word in s with the redacted marker,
+// unless it is part of a longer word.
+func redactWord(s, word string) string {
+	if word == "" {
+		return s
+	}
+	w := &strings.Builder{}
+	start, off := 0, 0
+	for {
+		i := strings.Index(s[off:], word)
+		if i < 0 {
+			break
+		}
+		i += off
+		j := i + len(word)
+		r, _ := utf8.DecodeLastRuneInString(s[:i])
+		t, _ := utf8.DecodeRuneInString(s[j:])
+		if isWordRune(r) || isWordRune(t) {
+			_, n := utf8.DecodeRuneInString(s[i:])
+			off = i + n
+			continue
+		}
+		w.WriteString(s[start:i])
+		w.WriteString(redacted)
+		start, off = j, j
+	}
+	w.WriteString(s[start:])
+	return w.String()
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
 }
 
 func errStr(err error) string {
@@ -17,19 +17,16 @@ var DBClient = NewCommand("db-client", "query a database").
 
 // GetCommand is a subcommand with dependencies injected into the handler by Wrap.
 var GetCommand = NewCommand("get", "Get DB resources").
-	HandleFunc(Wrap(Get))
+	HandleFuncC(Wrap(Get))
 
 // DeleteCommand is a subcommand with dependecnies injected into the handler by Wrap.
 var DeleteCommand = NewCommand("delete", "Delete DB resources").
-	HandleFunc(Wrap(Delete))
-
-// Wrap returns a HandlerFunc that initialises common dependencies for command handlers and then
-// injects them into fn.
-func Wrap(fn func(ctx context.Context, db *sql.DB) error) HandlerFunc {
-	return func(args []string) (exitCode int) {
-		// build a context
-		ctx := context.Background()
+	HandleFuncC(Wrap(Delete))
 
+// Wrap returns a HandlerFuncC that initialises common dependencies for command handlers and then
+// injects them into fn. The context is given by RunContext.
+func Wrap(fn func(ctx context.Context, db *sql.DB) error) HandlerFuncC {
+	return func(ctx context.Context, args []string) (exitCode int) {
 		// build a database connection
 		var db *sql.DB = nil
 
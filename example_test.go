@@ -101,7 +101,7 @@ func Example() {
 	//   -l, --language  Language (en, es, it or nl)
 	//
 	// Environment variables:
-	//   HW_LANG  Language (en, es, it or nl)
+	//   HW_LANG  --language  Language (en, es, it or nl)
 	//
 	// The helloworld utility writes "Hello, World!" to the standard
 	//  output multiple languages.
@@ -5,15 +5,15 @@ import (
 	"net"
 )
 
-// ipValue implements the Value interface for net.IP.
-type ipValue net.IP
+// exampleIPValue implements the Value interface for net.IP.
+type exampleIPValue net.IP
 
-func (p *ipValue) Set(s string) error {
+func (p *exampleIPValue) Set(s string) error {
 	ip := net.ParseIP(s)
 	if ip == nil {
 		return fmt.Errorf("invalid IP: %s", s)
 	}
-	*p = ipValue(ip)
+	*p = exampleIPValue(ip)
 	return nil
 }
 
@@ -22,7 +22,7 @@ func (p *ipValue) Set(s string) error {
 // net.IP variable in which to store the value of the flag.
 func IPVar(p *net.IP, name string, value net.IP, usage string) *FlagBuilder {
 	*p = value
-	return Var((*ipValue)(p), name, usage)
+	return Var((*exampleIPValue)(p), name, usage)
 }
 
 func ExampleValue() {
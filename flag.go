@@ -1,6 +1,9 @@
 package xflags
 
 import (
+	"bufio"
+	"fmt"
+	"os"
 	"strings"
 )
 
@@ -9,6 +12,18 @@ const (
 	defaultMaxNArgs = 1
 )
 
+// LinesMode controls which lines are read from a file by flags configured
+// with FlagBuilder.LinesFromFile.
+type LinesMode int
+
+const (
+	// SkipBlankLines ignores lines which are empty or contain only whitespace.
+	SkipBlankLines LinesMode = 1 << iota
+
+	// SkipComments ignores lines which begin with "#".
+	SkipComments
+)
+
 // Flagger is an interface that describes any type that produces a Flag.
 //
 // The interface is implemented by both FlagBuilder and Flag so they can often
@@ -19,8 +34,6 @@ type Flagger interface {
 
 // TODO: mutually exclusive flags?
 // TODO: error handling modes
-// TODO: support aliases
-// TODO: support negated bools
 
 // Flag describes a command line flag that may be specified on the command
 // line.
@@ -28,17 +41,36 @@ type Flagger interface {
 // Programs should not create Flag directly and instead use one of the
 // FlagBuilders to build one with proper error checking.
 type Flag struct {
-	Name        string
-	ShortName   string
-	Usage       string
-	ShowDefault bool
-	Positional  bool
-	MinCount    int
-	MaxCount    int
-	Hidden      bool
-	EnvVar      string
-	Validate    ValidateFunc
-	Value       Value
+	Name          string
+	ShortName     string
+	Aliases       []string
+	ShowAliases   bool
+	Usage         string
+	ShowDefault   bool
+	Positional    bool
+	MinCount      int
+	MaxCount      int
+	Hidden        bool
+	Deprecated    string
+	Negatable     bool
+	ValueOptional bool
+	BareValue     string
+	Sensitive     bool
+	AllowStdin    bool
+	FromFile      bool
+	LinesMode     LinesMode
+	Separator     string
+	EnvVar        string
+	EnvSeparator  string
+	Choices       []string
+	CompleteFunc  func(prefix string) []string
+	DefaultFunc   func() string
+	DefaultFrom   string
+	Validate      ValidateFunc
+	ValidateValue ValidateValueFunc
+	Value         Value
+
+	reset func()
 }
 
 // Flag implements the Flagger interface.
@@ -49,6 +81,25 @@ func (c *Flag) Flag() (*Flag, error) {
 	if c.Value == nil {
 		return nil, errorf("%s: value cannot be nil", c.name())
 	}
+	for _, alias := range c.Aliases {
+		if alias == "" || strings.HasPrefix(alias, "-") {
+			return nil, errorf("%s: invalid alias: %q", c.name(), alias)
+		}
+	}
+	if c.Negatable {
+		if c.Name == "" || c.Positional {
+			return nil, errorf("%s: only named flags may be negated", c.name())
+		}
+		if !isBoolValue(c.Value) {
+			return nil, errorf("%s: only boolean flags may be negated", c.name())
+		}
+	}
+	if c.EnvVar != "" && !isEnvVarName(c.EnvVar) {
+		return nil, errorf("%s: invalid environment variable name: %q", c.name(), c.EnvVar)
+	}
+	if c.ValueOptional && (c.Positional || isBoolValue(c.Value)) {
+		return nil, errorf("%s: only non-boolean named flags may have an optional value", c.name())
+	}
 	if len(c.ShortName) > 1 {
 		return nil, errorf(
 			"short name must be one character in length: %s",
@@ -70,7 +121,7 @@ func (c *Flag) Flag() (*Flag, error) {
 
 func (c *Flag) String() string {
 	if c.Positional {
-		return strings.ToUpper(c.Name)
+		return strings.ToUpper(c.name())
 	}
 	if c.Name != "" {
 		return "--" + c.Name
@@ -89,14 +140,92 @@ func (c *Flag) name() string {
 	return c.ShortName
 }
 
+// keys returns the command line names of the flag, including its dashes.
+func (c *Flag) keys() []string {
+	a := make([]string, 0, 2)
+	if c.Name != "" {
+		a = append(a, "--"+c.Name)
+	}
+	if c.ShortName != "" {
+		a = append(a, "-"+c.ShortName)
+	}
+	for _, alias := range c.Aliases {
+		a = append(a, "--"+alias)
+	}
+	return a
+}
+
+// envValues splits the value of an environment variable into the values to
+// set for this flag.
+func (c *Flag) envValues(s string) []string {
+	sep := c.EnvSeparator
+	if sep == "" && c.MaxCount != 1 {
+		sep = ","
+	}
+	if sep == "" {
+		return []string{s}
+	}
+	return strings.Split(s, sep)
+}
+
 // Set sets the value of the command-line flag.
+//
+// If the flag reads its values from a file, s is the path of the file and the
+// value is set once for each line in the file.
 func (c *Flag) Set(s string) error {
+	if c.FromFile {
+		return c.setLines(s)
+	}
+	return c.set(s)
+}
+
+func (c *Flag) setLines(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" && c.LinesMode&SkipBlankLines != 0 {
+			continue
+		}
+		if strings.HasPrefix(line, "#") && c.LinesMode&SkipComments != 0 {
+			continue
+		}
+		if err := c.set(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (c *Flag) set(s string) error {
+	if c.Separator != "" {
+		for _, v := range strings.Split(s, c.Separator) {
+			if err := c.setOne(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return c.setOne(s)
+}
+
+func (c *Flag) setOne(s string) error {
 	if c.Validate != nil {
 		if err := c.Validate(s); err != nil {
 			return err
 		}
 	}
-	return c.Value.Set(s)
+	if err := c.Value.Set(s); err != nil {
+		return err
+	}
+	if c.ValidateValue != nil {
+		return c.ValidateValue(c.Value)
+	}
+	return nil
 }
 
 // FlagGroup is a nominal grouping of flags which affects how the flags are
@@ -143,6 +272,78 @@ func (c *flagGroupBuilder) FlagGroup() (*FlagGroup, error) {
 // All chain methods return a pointer to the same builder.
 type FlagBuilder struct {
 	flag Flag
+	err  error
+}
+
+func (c *FlagBuilder) error(err error) *FlagBuilder {
+	if c.err != nil {
+		return c
+	}
+	c.err = err
+	return c
+}
+
+// resetTo specifies a function that restores the value of this flag to its
+// default when its command is reset.
+func (c *FlagBuilder) resetTo(fn func()) *FlagBuilder {
+	c.flag.reset = fn
+	return c
+}
+
+// Default specifies the default value of this flag as it would be given on the
+// command line. If the flag is not specified on the command line, in a config
+// file or by an environment variable, s is parsed as if it had been specified.
+// If ShowDefault is set, s is also shown as the default value in help messages.
+//
+// This decouples the default from the initial value of the variable, which is
+// useful for flags defined with Var for custom Value types. Default is
+// equivalent to DefaultFunc with a function that returns s.
+func (c *FlagBuilder) Default(s string) *FlagBuilder {
+	return c.DefaultFunc(func() string { return s })
+}
+
+// DefaultFunc specifies a function that computes the default value of this
+// flag when the command line is parsed. If the flag is not specified on the
+// command line, in a config file or by an environment variable, the result of
+// the function is parsed as if it had been specified. This is useful for
+// defaults that are not known when the command is built, such as paths
+// relative to the user's home directory.
+//
+// If ShowDefault is set, the function is also called to show the default
+// value in help messages. A computed default does not satisfy Required.
+func (c *FlagBuilder) DefaultFunc(fn func() string) *FlagBuilder {
+	c.flag.DefaultFunc = fn
+	return c
+}
+
+// OptionalValue specifies that a value is optional for this flag. If the flag
+// is given without a value, as in --color, it is set to the given value instead
+// of consuming the next argument. A value may still be given as --color=always
+// or -calways, but not as a separate argument: "--color always" sets the flag to
+// the bare value and "always" is parsed as a positional argument.
+//
+// This is intended for flags like git's --color[=WHEN] and is not supported for
+// boolean or positional flags.
+func (c *FlagBuilder) OptionalValue(bareValue string) *FlagBuilder {
+	c.flag.ValueOptional = true
+	c.flag.BareValue = bareValue
+	return c
+}
+
+// DefaultFromFlag specifies that if this flag is not otherwise specified, its
+// value defaults to the value of the named flag of the same command. E.g. an
+// --output-dir flag may default to the value of --workspace. The value is
+// copied after all other flags are set, including from config files,
+// environment variables and DefaultFunc, and is parsed as if it had been
+// specified. Nothing is copied if the value of the named flag is empty.
+//
+// This is intended for flags that accept a single value. The named flag must be
+// a regular flag declared by the same command and flags may not derive their
+// defaults from each other in a cycle. A derived default does not satisfy
+// Required.
+func (c *FlagBuilder) DefaultFromFlag(name string) *FlagBuilder {
+	c.flag.DefaultFrom = name
+	return c
 }
 
 // ShowDefault specifies that the default vlaue of this flag should be show in
@@ -160,6 +361,23 @@ func (c *FlagBuilder) ShortName(name string) *FlagBuilder {
 	return c
 }
 
+// Aliases specifies alternative long names for a command line flag. For
+// example, a flag named "color" with an alias of "colour" may be specified on
+// the command line with either "--color" or "--colour".
+//
+// Aliases are not shown in help messages unless ShowAliases is also specified.
+func (c *FlagBuilder) Aliases(names ...string) *FlagBuilder {
+	c.flag.Aliases = append(c.flag.Aliases, names...)
+	return c
+}
+
+// ShowAliases specifies that the aliases of this flag should be shown in help
+// messages.
+func (c *FlagBuilder) ShowAliases() *FlagBuilder {
+	c.flag.ShowAliases = true
+	return c
+}
+
 // Position indicates that this flag is a positional argument, and therefore has
 // no "-" or "--" delimeter. You cannot specify both a positional arguments and
 // subcommands.
@@ -179,8 +397,20 @@ func (c *FlagBuilder) NArgs(min, max int) *FlagBuilder {
 	return c
 }
 
+// Overwrite allows this flag to be specified on the command line any number of
+// times. Value.Set is called for each instance so, for scalar values such as
+// those created with String or Int, the last instance wins. Values which
+// accumulate, such as those created with Strings, are unaffected. It is
+// shorthand for NArgs(min, 0), preserving the current min count, and should be
+// called after Required if both are used.
+func (c *FlagBuilder) Overwrite() *FlagBuilder {
+	return c.NArgs(c.flag.MinCount, 0)
+}
+
 // Required is shorthand for NArgs(1, 1) and indicates that this flag must be
-// specified on the command line once and only once.
+// specified on the command line once and only once. A required flag is also
+// satisfied if it is set from its environment variable or a config file.
+// Required flags are marked as such in help messages.
 func (c *FlagBuilder) Required() *FlagBuilder {
 	return c.NArgs(1, 1)
 }
@@ -192,24 +422,230 @@ func (c *FlagBuilder) Hidden() *FlagBuilder {
 	return c
 }
 
+// Deprecated marks the flag as deprecated. The flag may still be specified on
+// the command line but a warning including msg is printed to the standard error
+// of the command each time it is. Deprecated flags are marked as such in help
+// messages unless they are also Hidden.
+func (c *FlagBuilder) Deprecated(msg string) *FlagBuilder {
+	c.flag.Deprecated = msg
+	return c
+}
+
+// Negatable allows a boolean flag to be set to false on the command line by
+// prefixing its name with "no-". For example, a flag named "verbose" may be
+// specified as "--verbose" or "--no-verbose".
+func (c *FlagBuilder) Negatable() *FlagBuilder {
+	c.flag.Negatable = true
+	return c
+}
+
+// Layouts specifies additional layouts, as defined by time.Parse, that are
+// accepted by a Time flag. Each layout is tried in order after the layout given
+// to Time until one succeeds. E.g. a flag may accept both a date and a date and
+// time. Layouts may only be specified for flags created with Time.
+func (c *FlagBuilder) Layouts(layouts ...string) *FlagBuilder {
+	v, ok := c.flag.Value.(*timeValue)
+	if !ok {
+		return c.error(errorf("%s: layouts may only be specified for time flags", c.flag.name()))
+	}
+	v.layouts = append(v.layouts, layouts...)
+	return c
+}
+
+// URLSchemes specifies the schemes, such as "https", that are accepted by a URL
+// flag. Schemes are compared case-insensitively. By default, any scheme is
+// accepted. Schemes may only be specified for flags created with URL.
+func (c *FlagBuilder) URLSchemes(schemes ...string) *FlagBuilder {
+	v, ok := c.flag.Value.(*urlValue)
+	if !ok {
+		return c.error(errorf("%s: schemes may only be specified for URL flags", c.flag.name()))
+	}
+	v.schemes = append(v.schemes, schemes...)
+	return c
+}
+
+// MustExist specifies that the path given for a FilePath flag must exist. The
+// default value of the flag is not checked.
+func (c *FlagBuilder) MustExist() *FlagBuilder {
+	return c.statPath(func(path string, fi os.FileInfo) error { return nil })
+}
+
+// MustBeFile specifies that the path given for a FilePath flag must exist and
+// must not be a directory. The default value of the flag is not checked.
+func (c *FlagBuilder) MustBeFile() *FlagBuilder {
+	return c.statPath(func(path string, fi os.FileInfo) error {
+		if fi.IsDir() {
+			return fmt.Errorf("is a directory: %s", path)
+		}
+		return nil
+	})
+}
+
+// MustBeDir specifies that the path given for a FilePath flag must exist and
+// must be a directory. The default value of the flag is not checked.
+func (c *FlagBuilder) MustBeDir() *FlagBuilder {
+	return c.statPath(func(path string, fi os.FileInfo) error {
+		if !fi.IsDir() {
+			return fmt.Errorf("not a directory: %s", path)
+		}
+		return nil
+	})
+}
+
+// statPath adds a validator to a FilePath flag which calls check with the
+// result of os.Stat for each path given.
+func (c *FlagBuilder) statPath(check func(path string, fi os.FileInfo) error) *FlagBuilder {
+	if _, ok := c.flag.Value.(*pathValue); !ok {
+		return c.error(errorf("%s: path checks may only be specified for file path flags", c.flag.name()))
+	}
+	return c.Validate(func(path string) error {
+		fi, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no such file or directory: %s", path)
+		}
+		if err != nil {
+			return err
+		}
+		return check(path, fi)
+	})
+}
+
+// Separator specifies that each value given for the flag is split on sep and
+// the flag value is set once for each part. E.g. with a separator of ",", the
+// argument "--dt 10s,15s" is equivalent to "--dt 10s --dt 15s". Separator is
+// typically used with slice flags such as Strings or Durations.
+func (c *FlagBuilder) Separator(sep string) *FlagBuilder {
+	c.flag.Separator = sep
+	return c
+}
+
+// Sensitive indicates that the value of this flag is secret, such as a
+// password. Any value given for the flag is redacted from error messages and
+// the default value is redacted from help messages if ShowDefault is
+// specified.
+func (c *FlagBuilder) Sensitive() *FlagBuilder {
+	c.flag.Sensitive = true
+	return c
+}
+
+// Secret is an alias for Sensitive.
+func (c *FlagBuilder) Secret() *FlagBuilder {
+	return c.Sensitive()
+}
+
+// AllowStdin specifies that if the value given for this flag on the command
+// line is "-", the value is instead read from the standard input of the command
+// until EOF, with any trailing newline removed. This allows secrets, such as
+// passwords, to be given without appearing in the process list or shell
+// history. E.g.
+//
+//     echo "$PASSWORD" | app --password -
+//
+// Standard input may only be read once per invocation. The input of a command
+// may be changed with CommandBuilder.Input.
+func (c *FlagBuilder) AllowStdin() *FlagBuilder {
+	c.flag.AllowStdin = true
+	return c
+}
+
+// LinesFromFile specifies that the value given for this flag is the path of a
+// file and that each line of the file is a distinct value for the flag. This
+// is intended for slice flags, such as Strings, which accumulate values.
+//
+// Surrounding whitespace is trimmed from each line. Blank lines and comments
+// may be ignored by specifying SkipBlankLines and SkipComments.
+func (c *FlagBuilder) LinesFromFile(modes ...LinesMode) *FlagBuilder {
+	c.flag.FromFile = true
+	for _, mode := range modes {
+		c.flag.LinesMode |= mode
+	}
+	return c
+}
+
 // Env allows the value of the flag to be specified with an environment variable
-// if it is not specified on the command line.
+// if it is not specified on the command line. The name may only contain
+// letters, digits and underscores and may not start with a digit, so that it
+// can be set from a shell. By convention, it should be uppercase.
+//
+// If the flag accepts more than one value, such as a Strings flag, the value of
+// the environment variable is split on "," and the flag is set once for each
+// part. Use EnvSeparator to split on a different separator.
 func (c *FlagBuilder) Env(name string) *FlagBuilder {
 	c.flag.EnvVar = name
 	return c
 }
 
+// EnvSeparator specifies the separator on which the value of the environment
+// variable for this flag is split before the flag is set once for each part.
+// E.g. ":" for variables in the style of PATH.
+func (c *FlagBuilder) EnvSeparator(sep string) *FlagBuilder {
+	c.flag.EnvSeparator = sep
+	return c
+}
+
 // Validate specifies a function to validate an argument for this flag before
 // it is parsed. If the function returns an error, parsing will fail with the
 // same error.
+//
+// Validate may be called multiple times. Validators are run in the order they
+// were specified and parsing stops at the first error.
 func (c *FlagBuilder) Validate(f ValidateFunc) *FlagBuilder {
-	c.flag.Validate = f
+	prev := c.flag.Validate
+	if prev == nil {
+		c.flag.Validate = f
+		return c
+	}
+	c.flag.Validate = func(arg string) error {
+		if err := prev(arg); err != nil {
+			return err
+		}
+		return f(arg)
+	}
+	return c
+}
+
+// ValidateValue specifies a function to validate the value of this flag after
+// each argument is parsed. This allows the parsed value to be inspected
+// without parsing the argument again. E.g. to check that an integer is within
+// a range. If the function returns an error, parsing will fail with the same
+// error.
+//
+// ValidateValue may be called multiple times. Validators are run in the order
+// they were specified and parsing stops at the first error.
+func (c *FlagBuilder) ValidateValue(f ValidateValueFunc) *FlagBuilder {
+	prev := c.flag.ValidateValue
+	if prev == nil {
+		c.flag.ValidateValue = f
+		return c
+	}
+	c.flag.ValidateValue = func(v Value) error {
+		if err := prev(v); err != nil {
+			return err
+		}
+		return f(v)
+	}
+	return c
+}
+
+// CompleteFunc specifies a function that returns the shell completion
+// candidates for the value of this flag that start with the given prefix. It is
+// called at runtime so that values which cannot be enumerated when the command
+// is built, such as the names of remote resources, may be completed. Any
+// candidates returned that do not start with prefix are ignored. CompleteFunc
+// takes precedence over Choices for completion.
+//
+// The completion scripts written by Command.WriteCompletion only call the
+// function if the root command was built with CommandBuilder.WithCompletion.
+func (c *FlagBuilder) CompleteFunc(fn func(prefix string) []string) *FlagBuilder {
+	c.flag.CompleteFunc = fn
 	return c
 }
 
 // Choices is a convenience method that calls Validate and sets a ValidateFunc
-// that enforces that the flag value must be one of the given choices.
+// that enforces that the flag value must be one of the given choices. The
+// choices are also offered by shell completion.
 func (c *FlagBuilder) Choices(elems ...string) *FlagBuilder {
+	c.flag.Choices = elems
 	return c.Validate(
 		func(arg string) error {
 			for _, elem := range elems {
@@ -228,6 +664,9 @@ func (c *FlagBuilder) Choices(elems ...string) *FlagBuilder {
 
 // Flag implements the Flagger interface and produces a new Flag.
 func (c *FlagBuilder) Flag() (*Flag, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
 	flag := c.flag
 	return flag.Flag()
 }
@@ -1,9 +1,15 @@
 package xflags
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"math/big"
 	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -25,11 +31,101 @@ func TestBitField(t *testing.T) {
 	assertInt64(t, 0x05, int64(v))
 }
 
+func TestBitFlags(t *testing.T) {
+	v := uint64(0x10)
+	flag := BitFlags(&v, 0xff, "features", "").Must()
+	if assertFlagParses(t, flag, "--features", "0x1", "--features=4", "--features", "0b10") {
+		assertUint64(t, 0x17, v)
+		assertString(t, "0x17", flag.Value.(fmt.Stringer).String())
+	}
+	for arg, expect := range map[string]string{
+		"0x100": "value 0x100 has bits outside of mask 0xff",
+		"x":     "invalid uint64: x",
+	} {
+		var argErr *ArgumentError
+		if assertErrorAs(t, parseFlag(flag, "--features", arg), &argErr) {
+			assertString(t, expect, argErr.Err.Error())
+		}
+	}
+}
+
+func TestAccumulate(t *testing.T) {
+	total := 1
+	flag := Accumulate(&total, "add", "", strconv.Atoi, func(acc, v int) int { return acc + v }).Must()
+	if assertFlagParses(t, flag, "--add=2", "--add=3") {
+		assertInt64(t, 6, int64(total))
+		assertString(t, "6", flag.Value.(fmt.Stringer).String())
+	}
+	assertErrorAs(t, parseFlag(flag, "--add=x"), new(*ArgumentError))
+
+	set := map[string]bool{}
+	flag = Accumulate(&set, "tag", "",
+		func(s string) (map[string]bool, error) { return map[string]bool{s: true}, nil },
+		func(acc, v map[string]bool) map[string]bool {
+			for k := range v {
+				acc[k] = true
+			}
+			return acc
+		},
+	).Must()
+	if assertFlagParses(t, flag, "--tag=a", "--tag=b", "--tag=a") {
+		assertInt64(t, 2, int64(len(set)))
+	}
+}
+
 func TestBool(t *testing.T) {
 	v := false
 	if assertFlagParses(t, Bool(&v, "foo", false, "").Must(), "--foo") {
 		assertBool(t, true, v)
 	}
+	for arg, expect := range map[string]bool{
+		"--foo=true":  true,
+		"--foo=false": false,
+		"--foo=1":     true,
+		"--foo=0":     false,
+		"--foo=T":     true,
+		"--foo=F":     false,
+		"-f=1":        true,
+		"-f=0":        false,
+	} {
+		v = !expect
+		if assertFlagParses(t, Bool(&v, "foo", false, "").ShortName("f").Must(), arg) {
+			assertBool(t, expect, v)
+		}
+	}
+	assertErrorAs(t, parseFlag(Bool(&v, "foo", false, "").Must(), "--foo=yes"), new(*ArgumentError))
+}
+
+func TestBoolDoesNotConsumeNextArg(t *testing.T) {
+	var verbose bool
+	var name string
+	cmd := NewCommand("test", "").
+		Flags(
+			Bool(&verbose, "verbose", true, "").ShortName("v"),
+			String(&name, "name", "", "").Positional(),
+		).
+		Must()
+	for _, args := range [][]string{
+		{"--verbose", "false"},
+		{"-v", "false"},
+	} {
+		verbose, name = false, ""
+		if _, err := cmd.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		assertBool(t, true, verbose)
+		assertString(t, "false", name)
+	}
+
+	// without a positional flag, the value is an unexpected argument
+	_, err := NewCommand("test", "").
+		Flags(Bool(&verbose, "verbose", false, "")).
+		Must().
+		Parse([]string{"--verbose", "true"})
+	var argErr *ArgumentError
+	if assertErrorAs(t, err, &argErr) {
+		assertString(t, "unexpected positional argument: true", argErr.Text)
+	}
 }
 
 func TestDuration(t *testing.T) {
@@ -39,6 +135,128 @@ func TestDuration(t *testing.T) {
 	}
 }
 
+func TestBigNumbers(t *testing.T) {
+	var i big.Int
+	flag := BigInt(&i, "num", big.NewInt(42), "").ShowDefault().Must()
+	assertString(t, "42", flag.Value.(fmt.Stringer).String())
+	if assertFlagParses(t, flag, "--num=123456789012345678901234567890") {
+		assertString(t, "123456789012345678901234567890", i.String())
+	}
+	if assertFlagParses(t, flag, "--num=-0x1ffffffffffffffff") {
+		assertString(t, "-36893488147419103231", i.String())
+	}
+	if assertFlagParses(t, flag, "--num=010") {
+		assertString(t, "10", i.String())
+	}
+
+	var f big.Float
+	flag = BigFloat(f.SetPrec(200), "num", nil, "").Must()
+	assertString(t, "0", flag.Value.(fmt.Stringer).String())
+	if assertFlagParses(t, flag, "--num=1e400") {
+		assertString(t, "1e+400", f.Text('g', -1))
+	}
+	if assertFlagParses(t, flag, "--num=9223372036854775808.5") {
+		assertString(t, "9223372036854775808.5", f.Text('f', -1))
+	}
+
+	errTests := []struct {
+		flag   *Flag
+		arg    string
+		expect string
+	}{
+		{BigInt(&i, "num", nil, "").Must(), "1.5", "invalid integer: 1.5"},
+		{BigFloat(&f, "num", nil, "").Must(), "x", "invalid number: x"},
+	}
+	for _, test := range errTests {
+		var argErr *ArgumentError
+		if assertErrorAs(t, parseFlag(test.flag, "--num="+test.arg), &argErr) {
+			assertString(t, test.expect, argErr.Err.Error())
+		}
+	}
+
+	// a failed parse does not modify the variable
+	flag = BigInt(&i, "num", nil, "").Must()
+	if assertFlagParses(t, flag, "--num=7") {
+		assertErrorAs(t, parseFlag(flag, "--num=1.5"), new(*ArgumentError))
+		assertString(t, "7", i.String())
+	}
+	flag = BigFloat(&f, "num", nil, "").Must()
+	if assertFlagParses(t, flag, "--num=7") {
+		assertErrorAs(t, parseFlag(flag, "--num=1.5x"), new(*ArgumentError))
+		assertString(t, "7", f.Text('g', -1))
+	}
+}
+
+func TestFilePath(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing")
+
+	var v string
+	tests := []struct {
+		flag   *Flag
+		arg    string
+		expect string
+	}{
+		{FilePath(&v, "path", "", "").Must(), missing, ""},
+		{FilePath(&v, "path", "", "").MustExist().Must(), file, ""},
+		{FilePath(&v, "path", "", "").MustExist().Must(), dir, ""},
+		{FilePath(&v, "path", "", "").MustExist().Must(), missing, "no such file or directory: " + missing},
+		{FilePath(&v, "path", "", "").MustBeFile().Must(), file, ""},
+		{FilePath(&v, "path", "", "").MustBeFile().Must(), dir, "is a directory: " + dir},
+		{FilePath(&v, "path", "", "").MustBeFile().Must(), missing, "no such file or directory: " + missing},
+		{FilePath(&v, "path", "", "").MustBeDir().Must(), dir, ""},
+		{FilePath(&v, "path", "", "").MustBeDir().Must(), file, "not a directory: " + file},
+	}
+	for _, test := range tests {
+		err := parseFlag(test.flag, "--path", test.arg)
+		if test.expect == "" {
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			assertString(t, test.arg, v)
+			continue
+		}
+		var argErr *ArgumentError
+		if assertErrorAs(t, err, &argErr) {
+			assertString(t, test.expect, argErr.Err.Error())
+		}
+	}
+
+	// defaults are not checked
+	if assertFlagParses(t, FilePath(&v, "path", missing, "").MustExist().Must()) {
+		assertString(t, missing, v)
+	}
+
+	if _, err := String(new(string), "foo", "", "").MustExist().Flag(); err == nil {
+		t.Errorf("expected error for path checks on a string flag")
+	}
+}
+
+func TestFloat32(t *testing.T) {
+	var v float32
+	flag := Float32(&v, "num", 0, "").Must()
+	if assertFlagParses(t, flag, "--num=1.5") {
+		assertString(t, "1.5", flag.Value.(fmt.Stringer).String())
+	}
+	if assertFlagParses(t, flag, "--num=0.1") {
+		assertString(t, "0.1", flag.Value.(fmt.Stringer).String())
+	}
+	for arg, expect := range map[string]string{
+		"1e39": "value out of range for float32: 1e39",
+		"x":    "invalid float32: x",
+	} {
+		var argErr *ArgumentError
+		if assertErrorAs(t, parseFlag(flag, "--num="+arg), &argErr) {
+			assertString(t, expect, argErr.Err.Error())
+		}
+	}
+}
+
 func TestFloat64(t *testing.T) {
 	var v float64
 	if assertFlagParses(t, Float64(&v, "foo", 0, "").Must(), "--foo=1.0") {
@@ -53,6 +271,409 @@ func TestInt64(t *testing.T) {
 	}
 }
 
+func TestFixedWidthInts(t *testing.T) {
+	var i8 int8
+	var i16 int16
+	var i32 int32
+	var u8 uint8
+	var u16 uint16
+	var u32 uint32
+	tests := []struct {
+		flag   *Flag
+		arg    string
+		expect string
+	}{
+		{Int8(&i8, "num", 0, "").Must(), "127", "127"},
+		{Int8(&i8, "num", 0, "").Must(), "-128", "-128"},
+		{Int16(&i16, "num", 0, "").Must(), "-32768", "-32768"},
+		{Int32(&i32, "num", 0, "").Must(), "2147483647", "2147483647"},
+		{Uint8(&u8, "num", 0, "").Must(), "255", "255"},
+		{Uint16(&u16, "num", 0, "").Must(), "65535", "65535"},
+		{Uint32(&u32, "num", 0, "").Must(), "4294967295", "4294967295"},
+	}
+	for _, test := range tests {
+		if assertFlagParses(t, test.flag, "--num="+test.arg) {
+			assertString(t, test.expect, test.flag.Value.(fmt.Stringer).String())
+		}
+	}
+
+	errTests := []struct {
+		flag   *Flag
+		arg    string
+		expect string
+	}{
+		{Int8(&i8, "num", 0, "").Must(), "128", "value out of range for int8: 128"},
+		{Int8(&i8, "num", 0, "").Must(), "-129", "value out of range for int8: -129"},
+		{Int16(&i16, "num", 0, "").Must(), "32768", "value out of range for int16: 32768"},
+		{Int32(&i32, "num", 0, "").Must(), "2147483648", "value out of range for int32: 2147483648"},
+		{Uint8(&u8, "num", 0, "").Must(), "256", "value out of range for uint8: 256"},
+		{Uint16(&u16, "num", 0, "").Must(), "65536", "value out of range for uint16: 65536"},
+		{Uint32(&u32, "num", 0, "").Must(), "4294967296", "value out of range for uint32: 4294967296"},
+		{Uint8(&u8, "num", 0, "").Must(), "-1", "invalid uint8: -1"},
+		{Int8(&i8, "num", 0, "").Must(), "x", "invalid int8: x"},
+	}
+	for _, test := range errTests {
+		err := parseFlag(test.flag, "--num="+test.arg)
+		var argErr *ArgumentError
+		if assertErrorAs(t, err, &argErr) {
+			assertString(t, test.expect, argErr.Err.Error())
+		}
+	}
+}
+
+func TestIntegerPrefixes(t *testing.T) {
+	tests := []struct {
+		arg    string
+		expect int64
+	}{
+		{"255", 255},
+		{"0xff", 255},
+		{"0XFF", 255},
+		{"0o755", 493},
+		{"0b1010", 10},
+		{"-0x10", -16},
+		{"+0b11", 3},
+		{"010", 10}, // leading zeros are decimal, not octal
+		{"0", 0},
+	}
+	for _, test := range tests {
+		var v int64
+		if assertFlagParses(t, Int64(&v, "foo", 0, "").Must(), "--foo", test.arg) {
+			assertInt64(t, test.expect, v)
+		}
+	}
+
+	var mode uint32
+	if assertFlagParses(t, Uint32(&mode, "mode", 0, "").Must(), "--mode=0o644") {
+		assertUint64(t, 0644, uint64(mode))
+	}
+	var masks []uint64
+	if assertFlagParses(t, Uint64s(&masks, "mask", nil, "").Must(), "--mask=0xffffffffffffffff") {
+		assertUint64(t, 1<<64-1, masks[0])
+	}
+
+	for _, arg := range []string{"0xfg", "0o8", "0b102", "0x"} {
+		var v int
+		err := parseFlag(Int(&v, "foo", 0, "").Must(), "--foo="+arg)
+		assertErrorAs(t, err, new(*ArgumentError))
+	}
+}
+
+func TestAllowStdin(t *testing.T) {
+	var password, token, name string
+	newCommand := func(input string) *Command {
+		return NewCommand("test", "").
+			Input(strings.NewReader(input)).
+			Flags(
+				String(&password, "password", "", "").AllowStdin().Sensitive(),
+				String(&token, "token", "", "").AllowStdin(),
+				String(&name, "name", "", ""),
+			).
+			Must()
+	}
+
+	for _, args := range [][]string{
+		{"--password", "-"},
+		{"--password=-"},
+	} {
+		password = ""
+		if _, err := newCommand("hunter2\n").Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		assertString(t, "hunter2", password)
+	}
+
+	// only a single trailing newline is removed
+	if _, err := newCommand("a\nb\r\n\n").Parse([]string{"--token", "-"}); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "a\nb\r\n", token)
+
+	// flags that do not allow stdin take "-" literally
+	if _, err := newCommand("x").Parse([]string{"--name", "-"}); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "-", name)
+
+	// stdin may only be read once
+	_, err := newCommand("x").Parse([]string{"--password", "-", "--token", "-"})
+	var argErr *ArgumentError
+	if assertErrorAs(t, err, &argErr) {
+		assertString(t, "--token: standard input was already read by --password", argErr.String())
+	}
+
+	// subcommands inherit the input
+	cmd := NewCommand("app", "").
+		Input(strings.NewReader("secret")).
+		Subcommands(
+			NewCommand("login", "").
+				Flags(String(&token, "token", "", "").AllowStdin()),
+		).
+		Must()
+	if _, err := cmd.Parse([]string{"login", "--token", "-"}); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "secret", token)
+}
+
+func TestDefaultFromFlag(t *testing.T) {
+	var workspace, outputDir, cacheDir string
+	newCommand := func() *Command {
+		return NewCommand("test", "").
+			Flags(
+				String(&cacheDir, "cache-dir", "", "").DefaultFromFlag("output-dir"),
+				String(&workspace, "workspace", "/src", ""),
+				String(&outputDir, "output-dir", "", "").DefaultFromFlag("workspace"),
+			).
+			Must()
+	}
+	tests := []struct {
+		args                           []string
+		workspace, outputDir, cacheDir string
+	}{
+		{nil, "/src", "/src", "/src"},
+		{[]string{"--workspace=/w"}, "/w", "/w", "/w"},
+		{[]string{"--workspace=/w", "--output-dir=/out"}, "/w", "/out", "/out"},
+		{[]string{"--cache-dir=/cache"}, "/src", "/src", "/cache"},
+	}
+	for _, test := range tests {
+		cmd := newCommand()
+		if _, err := cmd.Parse(test.args); err != nil {
+			t.Fatal(err)
+		}
+		assertString(t, test.workspace, workspace)
+		assertString(t, test.outputDir, outputDir)
+		assertString(t, test.cacheDir, cacheDir)
+
+		// derived defaults are not considered seen
+		if len(test.args) == 0 {
+			cmd.Visit(func(flag *Flag) {
+				t.Errorf("unexpected flag: %v", flag)
+			})
+		}
+	}
+
+	var a, b, c string
+	for _, cmd := range []Commander{
+		NewCommand("test", "").Flags(
+			String(&a, "a", "", "").DefaultFromFlag("b"),
+			String(&b, "b", "", "").DefaultFromFlag("a"),
+		),
+		NewCommand("test", "").Flags(
+			String(&a, "a", "", "").DefaultFromFlag("b"),
+			String(&b, "b", "", "").DefaultFromFlag("c"),
+			String(&c, "c", "", "").DefaultFromFlag("b"),
+		),
+		NewCommand("test", "").Flags(
+			String(&a, "a", "", "").DefaultFromFlag("a"),
+		),
+		NewCommand("test", "").Flags(
+			String(&a, "a", "", "").DefaultFromFlag("nope"),
+		),
+	} {
+		if _, err := cmd.Command(); err == nil {
+			t.Errorf("expected error")
+		}
+	}
+}
+
+func TestFlagOptionalValue(t *testing.T) {
+	var color string
+	var files []string
+	newCommand := func() *Command {
+		color, files = "never", nil
+		return NewCommand("test", "").
+			Flags(
+				String(&color, "color", "never", "").
+					ShortName("c").
+					OptionalValue("auto").
+					Choices("auto", "always", "never"),
+				Strings(&files, "file", nil, "").Positional().NArgs(0, 0),
+			).
+			Must()
+	}
+	tests := []struct {
+		args  []string
+		color string
+		files []string
+	}{
+		{nil, "never", nil},
+		{[]string{"--color"}, "auto", nil},
+		{[]string{"--color=always"}, "always", nil},
+		{[]string{"--color", "next"}, "auto", []string{"next"}},
+		{[]string{"-c"}, "auto", nil},
+		{[]string{"-calways"}, "always", nil},
+		{[]string{"-c=always", "next"}, "always", []string{"next"}},
+		{[]string{"a", "--color", "b"}, "auto", []string{"a", "b"}},
+	}
+	for _, test := range tests {
+		if _, err := newCommand().Parse(test.args); err != nil {
+			t.Errorf("%q: %v", test.args, err)
+			continue
+		}
+		assertString(t, test.color, color)
+		assertStrings(t, test.files, files)
+	}
+
+	// values are still validated
+	_, err := newCommand().Parse([]string{"--color=sometimes"})
+	assertErrorAs(t, err, new(*ArgumentError))
+
+	var b bool
+	if _, err := Bool(&b, "b", false, "").OptionalValue("true").Flag(); err == nil {
+		t.Errorf("expected error for boolean flag")
+	}
+	if _, err := String(&color, "color", "", "").Positional().OptionalValue("x").Flag(); err == nil {
+		t.Errorf("expected error for positional flag")
+	}
+}
+
+func TestOverwrite(t *testing.T) {
+	var name string
+	var tags []string
+	cmd := NewCommand("test", "").
+		Flags(
+			String(&name, "name", "", "").Overwrite(),
+			Strings(&tags, "tag", nil, "").Overwrite(),
+		).
+		Must()
+	if _, err := cmd.Parse([]string{"--name", "a", "--tag=x", "--name", "b", "--tag=y"}); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "b", name)
+	assertStrings(t, []string{"x", "y"}, tags)
+
+	// required flags may still be overwritten
+	flag := String(&name, "name", "", "").Required().Overwrite().Must()
+	if assertFlagParses(t, flag, "--name=c", "--name=d") {
+		assertString(t, "d", name)
+	}
+	var argErr *ArgumentError
+	if assertErrorAs(t, parseFlag(flag), &argErr) {
+		assertString(t, "--name: missing argument", argErr.String())
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "input.txt")
+	if err := ioutil.WriteFile(name, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var in, out *os.File
+	cmd := NewCommand("test", "").
+		Flags(
+			OpenFile(&in, "in", "", os.O_RDONLY, 0),
+			OpenFile(&out, "out", "", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644),
+		).
+		Must()
+	if _, err := cmd.Parse([]string{"--in", name, "--out", filepath.Join(dir, "output.txt")}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "hello", string(b))
+	assertString(t, name, cmd.Lookup("in").Value.(fmt.Stringer).String())
+	if _, err := out.WriteString("world"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.Read(b); err == nil {
+		t.Errorf("expected file to be closed")
+	}
+	b, err = ioutil.ReadFile(filepath.Join(dir, "output.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "world", string(b))
+
+	// "-" is the standard input or output and is never closed
+	if _, err := cmd.Parse([]string{"--in", "-", "--out", "-"}); err != nil {
+		t.Fatal(err)
+	}
+	if in != os.Stdin {
+		t.Errorf("expected standard input, got: %v", in)
+	}
+	if out != os.Stdout {
+		t.Errorf("expected standard output, got: %v", out)
+	}
+	if err := cmd.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// unset flags are nil
+	cmd.Reset()
+	if _, err := cmd.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	if in != nil || out != nil {
+		t.Errorf("expected nil files, got: %v, %v", in, out)
+	}
+
+	var argErr *ArgumentError
+	_, err = cmd.Parse([]string{"--in", filepath.Join(dir, "missing")})
+	assertErrorAs(t, err, &argErr)
+
+	// files opened before a parse error are closed
+	_, err = cmd.Parse([]string{"--in", name, "--out", filepath.Join(dir, "missing", "output.txt")})
+	assertErrorAs(t, err, &argErr)
+	if _, err := in.Read(b); err == nil {
+		t.Errorf("expected file to be closed after parse error")
+	}
+
+	// files are closed on reset
+	cmd.Reset()
+	if _, err := cmd.Parse([]string{"--in", name}); err != nil {
+		t.Fatal(err)
+	}
+	f := in
+	cmd.Reset()
+	if in != nil {
+		t.Errorf("expected nil file after reset, got: %v", in)
+	}
+	if _, err := f.Read(b); err == nil {
+		t.Errorf("expected file to be closed after reset")
+	}
+
+	// "-" is the input or output stream of the command
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	cmd = NewCommand("test", "").
+		Input(r).
+		Output(w, nil).
+		Flags(
+			OpenFile(&in, "in", "", os.O_RDONLY, 0),
+			OpenFile(&out, "out", "", os.O_WRONLY, 0),
+		).
+		Must()
+	if _, err := cmd.Parse([]string{"--in", "-", "--out", "-"}); err != nil {
+		t.Fatal(err)
+	}
+	if in != r {
+		t.Errorf("expected command input, got: %v", in)
+	}
+	if out != w {
+		t.Errorf("expected command output, got: %v", out)
+	}
+	_, err = NewCommand("test", "").
+		Input(strings.NewReader("hello")).
+		Flags(OpenFile(&in, "in", "", os.O_RDONLY, 0)).
+		Must().
+		Parse([]string{"--in", "-"})
+	if assertErrorAs(t, err, &argErr) {
+		assertString(t, "--in: standard input is not a file", argErr.String())
+	}
+}
+
 func TestString(t *testing.T) {
 	var v string
 	if assertFlagParses(t, String(&v, "foo", "", "").Must(), "--foo=bar") {
@@ -71,14 +692,382 @@ func TestStringSlice(t *testing.T) {
 	}
 }
 
+func TestStringMap(t *testing.T) {
+	var v map[string]string
+	flag := StringMap(&v, "label", "").Must()
+	if assertFlagParses(
+		t,
+		flag,
+		"--label", "a=1", "--label=b=2=3", "--label", "c=", "--label", "a=4",
+	) {
+		expect := map[string]string{"a": "4", "b": "2=3", "c": ""}
+		if len(v) != len(expect) {
+			t.Errorf("expected map: %v, got: %v", expect, v)
+		}
+		for k, s := range expect {
+			if actual, ok := v[k]; !ok || actual != s {
+				t.Errorf("expected %q=%q, got: %q", k, s, actual)
+			}
+		}
+	}
+	assertErrorAs(t, parseFlag(flag, "--label", "a"), new(*ArgumentError))
+}
+
+func TestNumericSlices(t *testing.T) {
+	var ints []int
+	var int64s []int64
+	var uint64s []uint64
+	var float64s []float64
+	cmd := NewCommand("test", "").
+		Flags(
+			Ints(&ints, "int", []int{1}, ""),
+			Int64s(&int64s, "int64", []int64{1}, ""),
+			Uint64s(&uint64s, "uint64", []uint64{1}, ""),
+			Float64s(&float64s, "float64", []float64{1}, ""),
+		).
+		Must()
+	_, err := cmd.Parse([]string{
+		"--int", "-2", "--int=3",
+		"--int64", "-9223372036854775808", "--int64", "4",
+		"--uint64", "18446744073709551615", "--uint64=5",
+		"--float64", "-0.5", "--float64", "1e3",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ints) != 2 || ints[0] != -2 || ints[1] != 3 {
+		t.Errorf("expected [-2 3], got: %v", ints)
+	}
+	if len(int64s) != 2 || int64s[0] != -9223372036854775808 || int64s[1] != 4 {
+		t.Errorf("expected [-9223372036854775808 4], got: %v", int64s)
+	}
+	if len(uint64s) != 2 || uint64s[0] != 18446744073709551615 || uint64s[1] != 5 {
+		t.Errorf("expected [18446744073709551615 5], got: %v", uint64s)
+	}
+	if len(float64s) != 2 || float64s[0] != -0.5 || float64s[1] != 1000 {
+		t.Errorf("expected [-0.5 1000], got: %v", float64s)
+	}
+
+	for _, args := range [][]string{
+		{"--int", "x"},
+		{"--int64", "1.5"},
+		{"--uint64", "-1"},
+		{"--float64", "y"},
+	} {
+		_, err := cmd.Parse(args)
+		assertErrorAs(t, err, new(*ArgumentError))
+	}
+}
+
+func TestDurations(t *testing.T) {
+	var v []time.Duration
+	expect := []time.Duration{10 * time.Second, 15 * time.Second}
+	for _, args := range [][]string{
+		{"--dt", "10s", "--dt", "15s"},
+		{"--dt", "10s,15s"},
+		{"--dt=10s", "--dt", "15s"},
+	} {
+		cmd := NewCommand("test", "").
+			Flags(Durations(&v, "dt", []time.Duration{time.Second}, "").Separator(",")).
+			Must()
+		if _, err := cmd.Parse(args); err != nil {
+			t.Error(err)
+			continue
+		}
+		if len(v) != len(expect) || v[0] != expect[0] || v[1] != expect[1] {
+			t.Errorf("%q: expected %v, got: %v", args, expect, v)
+		}
+	}
+	flag := Durations(&v, "dt", nil, "").Separator(",").Must()
+	assertErrorAs(t, parseFlag(flag, "--dt", "10s,x"), new(*ArgumentError))
+}
+
+func TestSeparator(t *testing.T) {
+	var v []string
+	flag := Strings(&v, "tag", nil, "").Separator(":").Must()
+	if assertFlagParses(t, flag, "--tag", "a:b", "--tag", "c") {
+		assertStrings(t, []string{"a", "b", "c"}, v)
+	}
+}
+
+func TestURL(t *testing.T) {
+	var v *url.URL
+	def := &url.URL{Scheme: "https", Host: "example.com"}
+	flag := URL(&v, "endpoint", def, "").URLSchemes("http", "https").Must()
+	assertString(t, "https://example.com", flag.Value.(fmt.Stringer).String())
+	if assertFlagParses(t, flag, "--endpoint", "HTTP://localhost:8080/api?v=1") {
+		assertString(t, "localhost:8080", v.Host)
+		assertString(t, "http://localhost:8080/api?v=1", flag.Value.(fmt.Stringer).String())
+	}
+
+	errTests := []struct {
+		arg    string
+		expect string
+	}{
+		{"ftp://example.com", "URL scheme must be one of: http, https"},
+		{"example.com", "URL scheme must be one of: http, https"},
+		{"http://[::1", `parse "http://[::1": missing ']' in host`},
+	}
+	for _, test := range errTests {
+		var argErr *ArgumentError
+		if assertErrorAs(t, parseFlag(flag, "--endpoint", test.arg), &argErr) {
+			assertString(t, test.expect, argErr.Err.Error())
+		}
+	}
+
+	if _, err := String(new(string), "foo", "", "").URLSchemes("https").Flag(); err == nil {
+		t.Errorf("expected error for schemes on a string flag")
+	}
+}
+
+func TestTime(t *testing.T) {
+	var v time.Time
+	flag := Time(&v, "since", time.Time{}, "", "").Must()
+	if assertFlagParses(t, flag, "--since", "2021-03-04T05:06:07Z") {
+		expect := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+		if !v.Equal(expect) {
+			t.Errorf("expected time: %v, got: %v", expect, v)
+		}
+		assertString(t, "2021-03-04T05:06:07Z", flag.Value.(fmt.Stringer).String())
+	}
+	assertErrorAs(t, parseFlag(flag, "--since", "2021-03-04"), new(*ArgumentError))
+
+	flag = Time(&v, "since", time.Time{}, "2006-01-02 15:04", "").
+		Layouts("2006-01-02").
+		Must()
+	testCases := map[string]time.Time{
+		"2021-03-04 05:06": time.Date(2021, 3, 4, 5, 6, 0, 0, time.UTC),
+		"2021-03-04":       time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC),
+	}
+	for arg, expect := range testCases {
+		if assertFlagParses(t, flag, "--since", arg) && !v.Equal(expect) {
+			t.Errorf("expected time: %v, got: %v", expect, v)
+		}
+	}
+	assertErrorAs(t, parseFlag(flag, "--since", "03/04/2021"), new(*ArgumentError))
+
+	if _, err := String(new(string), "foo", "", "").Layouts("2006").Flag(); err == nil {
+		t.Errorf("expected error for layouts on a string flag")
+	}
+}
+
+type logLevel int
+
+const (
+	logDebug logLevel = iota
+	logInfo
+	logError
+)
+
+func TestEnum(t *testing.T) {
+	levels := map[string]logLevel{
+		"debug": logDebug,
+		"info":  logInfo,
+		"error": logError,
+	}
+	level := logInfo
+	flag := Enum(&level, "level", "", levels).Must()
+	assertString(t, "info", flag.Value.(fmt.Stringer).String())
+	assertStrings(t, []string{"debug", "error", "info"}, flag.Choices)
+	if assertFlagParses(t, flag) && level != logInfo {
+		t.Errorf("expected default level %v, got: %v", logInfo, level)
+	}
+	if assertFlagParses(t, flag, "--level", "error") {
+		if level != logError {
+			t.Errorf("expected level %v, got: %v", logError, level)
+		}
+		assertString(t, "error", flag.Value.(fmt.Stringer).String())
+	}
+	assertErrorAs(t, parseFlag(flag, "--level", "warn"), new(*ArgumentError))
+	if level != logError {
+		t.Errorf("expected level to be unchanged after error, got: %v", level)
+	}
+}
+
+// pointValue is a custom Value with no String method.
+type pointValue struct{ x, y int }
+
+func (p *pointValue) Set(s string) error {
+	_, err := fmt.Sscanf(s, "%d,%d", &p.x, &p.y)
+	return err
+}
+
+func TestDefault(t *testing.T) {
+	var p pointValue
+	newCommand := func() *Command {
+		p = pointValue{}
+		return NewCommand("test", "").
+			Flags(
+				Var(&p, "origin", "Origin point").
+					Default("3,4").
+					ShowDefault(),
+			).
+			Must()
+	}
+
+	cmd := newCommand()
+	if _, err := cmd.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	assertInt64(t, 3, int64(p.x))
+	assertInt64(t, 4, int64(p.y))
+	cmd.Visit(func(flag *Flag) {
+		t.Errorf("default should not be considered seen: %v", flag)
+	})
+
+	if _, err := newCommand().Parse([]string{"--origin=5,6"}); err != nil {
+		t.Fatal(err)
+	}
+	assertInt64(t, 5, int64(p.x))
+	assertInt64(t, 6, int64(p.y))
+
+	w := &bytes.Buffer{}
+	if err := Format(w, newCommand()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(w.String(), "Origin point (default: 3,4)") {
+		t.Errorf("expected default in help, got:\n%s", w)
+	}
+
+	// invalid defaults are reported when the command line is parsed
+	_, err := NewCommand("test", "").
+		Flags(Var(&p, "origin", "").Default("nope")).
+		Must().
+		Parse(nil)
+	assertErrorAs(t, err, new(*ArgumentError))
+}
+
+func TestDefaultFunc(t *testing.T) {
+	var dir string
+	calls := 0
+	newCommand := func() *Command {
+		dir, calls = "", 0
+		return NewCommand("test", "").
+			Flags(
+				String(&dir, "dir", "", "Config directory").
+					ShowDefault().
+					DefaultFunc(func() string {
+						calls++
+						return "/home/test/.config"
+					}),
+			).
+			Must()
+	}
+
+	if _, err := newCommand().Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "/home/test/.config", dir)
+	if calls != 1 {
+		t.Errorf("expected 1 call, got %d", calls)
+	}
+
+	if _, err := newCommand().Parse([]string{"--dir", "/etc"}); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "/etc", dir)
+	if calls != 0 {
+		t.Errorf("expected 0 calls, got %d", calls)
+	}
+
+	w := &bytes.Buffer{}
+	if err := Format(w, newCommand()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(w.String(), "(default: /home/test/.config)") {
+		t.Errorf("expected computed default in help, got:\n%s", w)
+	}
+}
+
 func TestFlagChoices(t *testing.T) {
 	var v string
 	flag := String(&v, "foo", "", "").Choices("bar", "baz").Must()
 	assertFlagParses(t, flag, "--foo=bar")
 	assertFlagParses(t, flag, "--foo=baz")
-	assertErrorAs(t, parseFlag(flag, "--foo=qux"), &ArgumentError{})
-	assertErrorAs(t, parseFlag(flag, "--foo=ba"), &ArgumentError{})
-	assertErrorAs(t, parseFlag(flag, "--foo=barr"), &ArgumentError{})
+	assertErrorAs(t, parseFlag(flag, "--foo=qux"), new(*ArgumentError))
+	assertErrorAs(t, parseFlag(flag, "--foo=ba"), new(*ArgumentError))
+	assertErrorAs(t, parseFlag(flag, "--foo=barr"), new(*ArgumentError))
+}
+
+func TestFlagValidateChain(t *testing.T) {
+	var v string
+	var calls []string
+	validator := func(name, invalid string) ValidateFunc {
+		return func(arg string) error {
+			calls = append(calls, name)
+			if arg == invalid {
+				return fmt.Errorf("%s: invalid argument: %s", name, arg)
+			}
+			return nil
+		}
+	}
+	flag := String(&v, "foo", "", "").
+		Choices("bar", "baz", "qux").
+		Validate(validator("first", "baz")).
+		Validate(validator("second", "qux")).
+		Must()
+
+	calls = nil
+	assertFlagParses(t, flag, "--foo=bar")
+	assertStrings(t, []string{"first", "second"}, calls)
+
+	calls = nil
+	err := parseFlag(flag, "--foo=baz")
+	var argErr *ArgumentError
+	if assertErrorAs(t, err, &argErr) {
+		assertString(t, "--foo: first: invalid argument: baz", argErr.String())
+	}
+	assertStrings(t, []string{"first"}, calls)
+
+	calls = nil
+	err = parseFlag(flag, "--foo=qux")
+	if assertErrorAs(t, err, &argErr) {
+		assertString(t, "--foo: second: invalid argument: qux", argErr.String())
+	}
+	assertStrings(t, []string{"first", "second"}, calls)
+
+	// choices are validated first
+	calls = nil
+	assertErrorAs(t, parseFlag(flag, "--foo=quux"), new(*ArgumentError))
+	assertStrings(t, []string{}, calls)
+}
+
+func TestFlagValidateValue(t *testing.T) {
+	var n int
+	flag := Int(&n, "n", 0, "").
+		ValidateValue(func(v Value) error {
+			if n < 1 || n > 10 {
+				return fmt.Errorf("out of range: %d", n)
+			}
+			return nil
+		}).
+		Must()
+	assertFlagParses(t, flag, "-n=1")
+	assertFlagParses(t, flag, "-n=10")
+	err := parseFlag(flag, "-n=11")
+	var argErr *ArgumentError
+	if assertErrorAs(t, err, &argErr) {
+		assertString(t, "-n: out of range: 11", argErr.String())
+	}
+
+	// validate each occurrence
+	var a []int
+	calls := 0
+	flag = Ints(&a, "a", nil, "").
+		ValidateValue(func(v Value) error {
+			calls++
+			if len(a) != calls {
+				return fmt.Errorf("expected %d values, got %d", calls, len(a))
+			}
+			return nil
+		}).
+		Must()
+	if err := parseFlag(flag, "-a=1", "-a=2", "-a=3"); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
 }
 
 func ExampleFlagBuilder_Validate() {
@@ -179,3 +1168,356 @@ func ExampleStrings() {
 	RunWithArgs(cmd, "--name=foo", "--name=bar")
 	// Output: Created new widgets: foo, bar
 }
+
+func TestFlagSensitive(t *testing.T) {
+	var v string
+	flag := String(&v, "password", "", "").
+		Sensitive().
+		Validate(func(arg string) error {
+			return fmt.Errorf("invalid password: %s", arg)
+		}).
+		Must()
+	err := parseFlag(flag, "--password=hunter2")
+	var argErr *ArgumentError
+	if !assertErrorAs(t, err, &argErr) {
+		return
+	}
+	assertString(t, "****", argErr.Arg)
+	assertString(t, "--password: invalid password: ****", argErr.String())
+	if strings.Contains(argErr.Error(), "hunter2") {
+		t.Errorf("sensitive value leaked in error: %v", argErr)
+	}
+
+	v = ""
+	cmd := NewCommand("test", "").
+		Flags(String(&v, "password", "hunter2", "Password").Sensitive().ShowDefault()).
+		Must()
+	w := &bytes.Buffer{}
+	if err := Format(w, cmd); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(w.String(), "hunter2") {
+		t.Errorf("sensitive value leaked in help:\n%s", w)
+	}
+	if !strings.Contains(w.String(), "(default: ****)") {
+		t.Errorf("expected redacted default in help:\n%s", w)
+	}
+
+	flag = String(&v, "password", "", "").Secret().Must()
+	assertBool(t, true, flag.Sensitive)
+}
+
+func TestFlagSensitiveShortSecret(t *testing.T) {
+	var v string
+	flag := String(&v, "password", "", "").
+		Sensitive().
+		Validate(func(arg string) error {
+			return fmt.Errorf("invalid argument: %s", arg)
+		}).
+		Must()
+	err := parseFlag(flag, "--password", "a")
+	var argErr *ArgumentError
+	if !assertErrorAs(t, err, &argErr) {
+		return
+	}
+	assertString(t, "****", argErr.Arg)
+	assertString(t, "--password: invalid argument: ****", argErr.String())
+}
+
+func TestForceReason(t *testing.T) {
+	testCases := []struct {
+		args   []string
+		force  bool
+		reason string
+	}{
+		{[]string{}, false, ""},
+		{[]string{"--force"}, true, ""},
+		{[]string{"--force=maintenance window"}, true, "maintenance window"},
+		{[]string{"-f=maintenance window"}, true, "maintenance window"},
+		{[]string{"--force=false"}, false, ""},
+		{[]string{"--force=0"}, false, ""},
+		{[]string{"--force=true"}, true, ""},
+		{[]string{"--no-force"}, false, ""},
+	}
+	for _, testCase := range testCases {
+		var force bool
+		var reason string
+		flag := ForceReason(&force, &reason, "force", "").ShortName("f").Negatable().Must()
+		if !assertFlagParses(t, flag, testCase.args...) {
+			continue
+		}
+		assertBool(t, testCase.force, force)
+		assertString(t, testCase.reason, reason)
+	}
+
+	// a bare flag does not consume the next argument
+	var force bool
+	var reason string
+	flag := ForceReason(&force, &reason, "force", "").Must()
+	assertErrorAs(t, parseFlag(flag, "--force", "reason"), new(*ArgumentError))
+}
+
+func TestQuantity(t *testing.T) {
+	testCases := []struct {
+		arg    string
+		milli  bool
+		expect int64
+		str    string
+	}{
+		{"0", false, 0, "0"},
+		{"100", false, 100, "100"},
+		{"1k", false, 1000, "1k"},
+		{"512Mi", false, 512 << 20, "512Mi"},
+		{"1.5Gi", false, 3 << 29, "1536Mi"},
+		{"2G", false, 2e9, "2G"},
+		{"-1Ki", false, -1024, "-1Ki"},
+		{"1000m", false, 1, "1"},
+		{"500m", true, 500, "500m"},
+		{"0.5", true, 500, "500m"},
+		{"2", true, 2000, "2"},
+		{"1.5k", true, 1500000, "1500"},
+	}
+	for _, testCase := range testCases {
+		var v int64
+		builder := Quantity(&v, "foo", "")
+		if testCase.milli {
+			builder = MilliQuantity(&v, "foo", "")
+		}
+		flag := builder.Must()
+		if !assertFlagParses(t, flag, "--foo="+testCase.arg) {
+			continue
+		}
+		assertInt64(t, testCase.expect, v)
+		assertString(t, testCase.str, flag.Value.(fmt.Stringer).String())
+	}
+
+	errorCases := []string{"", "Mi", "1.2.3", "1Xi", "500m", "0.5", "16Ei"}
+	for _, arg := range errorCases {
+		var v int64
+		flag := Quantity(&v, "foo", "").Must()
+		assertErrorAs(t, parseFlag(flag, "--foo="+arg), new(*ArgumentError))
+	}
+}
+
+func TestBytes(t *testing.T) {
+	testCases := []struct {
+		arg    string
+		expect int64
+		str    string
+	}{
+		{"0", 0, "0B"},
+		{"100", 100, "100B"},
+		{"100B", 100, "100B"},
+		{"10MB", 10e6, "10MB"},
+		{"10M", 10e6, "10MB"},
+		{"1kB", 1000, "1kB"},
+		{"1KB", 1000, "1kB"},
+		{"512KiB", 512 << 10, "512KiB"},
+		{"512Ki", 512 << 10, "512KiB"},
+		{"1.5G", 1.5e9, "1500MB"},
+		{"1.5GiB", 3 << 29, "1536MiB"},
+		{"1536", 1536, "1536B"},
+	}
+	for _, testCase := range testCases {
+		var v int64
+		flag := Bytes(&v, "size", 0, "").Must()
+		if !assertFlagParses(t, flag, "--size="+testCase.arg) {
+			continue
+		}
+		assertInt64(t, testCase.expect, v)
+		assertString(t, testCase.str, flag.Value.(fmt.Stringer).String())
+	}
+
+	errorCases := []string{"", "MB", "10XB", "10mb", "0.5B", "1.2.3", "16EiB"}
+	for _, arg := range errorCases {
+		var v int64
+		flag := Bytes(&v, "size", 0, "").Must()
+		assertErrorAs(t, parseFlag(flag, "--size="+arg), new(*ArgumentError))
+	}
+}
+
+func TestLinesFromFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "xflags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprint(f, "foo\n\n  bar  \n# comment\nbaz\n")
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("AllLines", func(t *testing.T) {
+		var v []string
+		flag := Strings(&v, "hosts-file", nil, "").LinesFromFile().Must()
+		if assertFlagParses(t, flag, "--hosts-file", f.Name()) {
+			assertStrings(t, []string{"foo", "", "bar", "# comment", "baz"}, v)
+		}
+	})
+	t.Run("SkipLines", func(t *testing.T) {
+		var v []string
+		flag := Strings(&v, "hosts-file", nil, "").
+			LinesFromFile(SkipBlankLines, SkipComments).
+			Must()
+		if assertFlagParses(t, flag, "--hosts-file", f.Name()) {
+			assertStrings(t, []string{"foo", "bar", "baz"}, v)
+		}
+	})
+	t.Run("MissingFile", func(t *testing.T) {
+		var v []string
+		flag := Strings(&v, "hosts-file", nil, "").LinesFromFile().Must()
+		err := parseFlag(flag, "--hosts-file", f.Name()+".missing")
+		assertErrorAs(t, err, new(*ArgumentError))
+	})
+}
+
+func TestIP(t *testing.T) {
+	var v net.IP
+	flag := IP(&v, "ip", nil, "").Must()
+	assertString(t, "", flag.Value.(fmt.Stringer).String())
+	if assertFlagParses(t, flag, "--ip=2001:0db8::0001") {
+		assertString(t, "2001:db8::1", v.String())
+		assertString(t, "2001:db8::1", flag.Value.(fmt.Stringer).String())
+	}
+	assertErrorAs(t, parseFlag(flag, "--ip=256.0.0.1"), new(*ArgumentError))
+}
+
+func TestIPNet(t *testing.T) {
+	var v net.IPNet
+	flag := IPNet(&v, "cidr", net.IPNet{}, "").Must()
+	assertString(t, "", flag.Value.(fmt.Stringer).String())
+	if assertFlagParses(t, flag, "--cidr=192.0.2.1/24") {
+		assertString(t, "192.0.2.0/24", v.String())
+		assertString(t, "192.0.2.0/24", flag.Value.(fmt.Stringer).String())
+	}
+	assertErrorAs(t, parseFlag(flag, "--cidr=192.0.2.1"), new(*ArgumentError))
+}
+
+func TestCount(t *testing.T) {
+	var v int
+	flag := Count(&v, "v", "").Must()
+	if assertFlagParses(t, flag, "-v", "-v") {
+		assertInt64(t, 2, int64(v))
+	}
+	flag = Count(&v, "v", "").Must()
+	if assertFlagParses(t, flag, "-vvv") {
+		assertInt64(t, 3, int64(v))
+	}
+	flag = Count(&v, "v", "").Must()
+	if assertFlagParses(t, flag) {
+		assertInt64(t, 0, int64(v))
+	}
+	flag = Count(&v, "v", "").NArgs(0, 2).Must()
+	assertErrorAs(t, parseFlag(flag, "-v", "-v", "-v"), new(*ArgumentError))
+}
+
+func TestNegatable(t *testing.T) {
+	v := true
+	flag := Bool(&v, "verbose", true, "").Negatable().Must()
+	if assertFlagParses(t, flag, "--no-verbose") {
+		assertBool(t, false, v)
+	}
+	assertErrorAs(t, parseFlag(flag, "--no-verbose", "--verbose"), new(*ArgumentError))
+	assertErrorAs(t, parseFlag(flag, "--no-verbose=true"), new(*ArgumentError))
+
+	// without Negatable, the prefix is not recognized
+	flag = Bool(&v, "verbose", true, "").Must()
+	assertErrorAs(t, parseFlag(flag, "--no-verbose"), new(*ArgumentError))
+
+	// only named bool flags may be negated
+	var s string
+	if _, err := String(&s, "name", "", "").Negatable().Flag(); err == nil {
+		t.Errorf("expected error for negatable string flag")
+	}
+	if _, err := Bool(&v, "v", false, "").Negatable().Flag(); err == nil {
+		t.Errorf("expected error for negatable short flag")
+	}
+
+	// negated names must not collide with other flags
+	var w bool
+	_, err := NewCommand("test", "").
+		Flags(
+			Bool(&v, "verbose", false, "").Negatable(),
+			Bool(&w, "no-verbose", false, ""),
+		).
+		Command()
+	if err == nil {
+		t.Errorf("expected error for colliding negated flag name")
+	}
+}
+
+func ExampleFlagBuilder_Negatable() {
+	color := true
+
+	cmd := NewCommand("ls", "").
+		Flags(
+			Bool(&color, "color", true, "Colorize the output").Negatable(),
+		).
+		HandleFunc(func(args []string) (exitCode int) {
+			fmt.Printf("Color: %v\n", color)
+			return
+		})
+
+	RunWithArgs(cmd, "--help")
+	RunWithArgs(cmd, "--no-color")
+	// Output:
+	// Usage: ls [OPTIONS]
+	//
+	// Options:
+	//    --[no-]color  Colorize the output
+	// Color: false
+}
+
+func TestAliases(t *testing.T) {
+	for _, arg := range []string{"--color=always", "--colour=always", "-c=always"} {
+		var v string
+		flag := String(&v, "color", "", "").
+			ShortName("c").
+			Aliases("colour").
+			Must()
+		if assertFlagParses(t, flag, arg) {
+			assertString(t, "always", v)
+		}
+	}
+
+	var v, w string
+	_, err := NewCommand("test", "").
+		Flags(
+			String(&v, "color", "", "").Aliases("colour"),
+			String(&w, "colour", "", ""),
+		).
+		Command()
+	if err == nil {
+		t.Errorf("expected error for duplicate alias")
+	}
+	if _, err := String(&v, "color", "", "").Aliases("--colour").Flag(); err == nil {
+		t.Errorf("expected error for invalid alias")
+	}
+}
+
+func ExampleFlagBuilder_Aliases() {
+	var color, format string
+
+	cmd := NewCommand("ls", "").
+		Flags(
+			String(&color, "color", "auto", "Colorize the output").
+				Aliases("colour"),
+			String(&format, "format", "long", "Output format").
+				Aliases("fmt").
+				ShowAliases(),
+		).
+		HandleFunc(func(args []string) (exitCode int) {
+			fmt.Printf("Color: %s\n", color)
+			return
+		})
+
+	RunWithArgs(cmd, "--help")
+	RunWithArgs(cmd, "--colour=never")
+	// Output:
+	// Usage: ls [OPTIONS]
+	//
+	// Options:
+	//    --color          Colorize the output
+	//    --format, --fmt  Output format
+	// Color: never
+}
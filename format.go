@@ -1,36 +1,68 @@
 package xflags
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"os"
+	"sort"
 	"strings"
 	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// defaultHelpWidth is the width to which help messages are wrapped if the
+// output is not a terminal.
+const defaultHelpWidth = 80
+
+// minHelpColumnWidth is the narrowest column to which descriptions in help
+// messages are wrapped. Narrower columns are not wrapped at all.
+const minHelpColumnWidth = 16
+
+// RequiredMarker is the style in which required flags are marked in help
+// messages.
+type RequiredMarker int
+
+// These constants specify how required flags are marked in help messages.
+const (
+	RequiredText     RequiredMarker = iota + 1 // Append "(required)" to the usage (default).
+	RequiredAsterisk                           // Append "*" to the flag name.
+	RequiredNone                               // Do not mark required flags.
 )
 
 // FormatFunc is a function that prints a help message for a command.
 type FormatFunc func(w io.Writer, cmd *Command) error
 
+// DefaultFormat is the FormatFunc used to print help messages for commands
+// which, like all of their ancestors, have no FormatFunc of their own. It may
+// be reassigned to change the help messages of all such commands in a
+// program. If the --help-all argument is specified, it is called with a copy
+// of the command in which hidden flags and subcommands are visible.
+var DefaultFormat FormatFunc = Format
+
 // Format is the default FormatFunc to print help messages for a commands.
+//
+// It is composed of the WriteUsageLine, WritePositionals, WriteFlagGroups,
+// WriteSubcommands and WriteEnvVars functions, which may be used to build a
+// custom FormatFunc with a different layout.
 func Format(w io.Writer, cmd *Command) error {
 	aw := newAggregatedWriter(w)
-	if err := printUsage(aw, cmd); err != nil {
+	if err := WriteUsageLine(aw, cmd); err != nil {
 		return err
 	}
 	if cmd.Usage != "" {
 		fmt.Fprintf(aw, "\n%s\n", cmd.Usage)
 	}
-	if err := detailPositionals(aw, cmd); err != nil {
+	if err := WritePositionals(aw, cmd); err != nil {
 		return err
 	}
-	for _, group := range cmd.FlagGroups {
-		if err := detailFlagGroup(aw, group); err != nil {
-			return err
-		}
+	if err := WriteFlagGroups(aw, cmd); err != nil {
+		return err
 	}
-	if err := detailSubcommands(aw, cmd.Subcommands); err != nil {
+	if err := WriteSubcommands(aw, cmd); err != nil {
 		return err
 	}
-	if err := detailEnvVars(aw, cmd); err != nil {
+	if err := WriteEnvVars(aw, cmd); err != nil {
 		return err
 	}
 	if cmd.Synopsis != "" {
@@ -39,6 +71,314 @@ func Format(w io.Writer, cmd *Command) error {
 	return aw.Err()
 }
 
+// WriteUsageLine writes the usage line of a command to w. E.g.
+// "Usage: app [OPTIONS] COMMAND".
+func WriteUsageLine(w io.Writer, cmd *Command) error {
+	return printUsage(w, cmd)
+}
+
+// WritePositionals writes the section of a help message which describes the
+// positional arguments of a command to w. Nothing is written if the command
+// has no positional arguments.
+//
+// Like all sections written by the Write functions of this package, the section
+// starts with a blank line and a heading, and its columns are aligned and
+// wrapped to the help width of the command.
+func WritePositionals(w io.Writer, cmd *Command) error {
+	return detailPositionals(w, cmd, newHelpStyle(w, cmd))
+}
+
+// WriteFlagGroups writes a section of a help message for each flag group of a
+// command to w, followed by a section for the flags inherited from its
+// ancestors. Groups with no visible flags are omitted.
+func WriteFlagGroups(w io.Writer, cmd *Command) error {
+	return detailFlagGroups(w, cmd, newHelpStyle(w, cmd))
+}
+
+// WriteFlagGroup writes the section of a help message which describes the
+// regular flags in group to w, formatted as configured for cmd. Nothing is
+// written if the group has no visible flags.
+func WriteFlagGroup(w io.Writer, cmd *Command, group *FlagGroup) error {
+	if cmd.sortFlags() {
+		group = sortedFlagGroup(group)
+	}
+	return detailFlagGroup(w, group, requiredMarker(cmd), newHelpStyle(w, cmd))
+}
+
+// WriteSubcommands writes the section of a help message which lists the
+// subcommands of a command to w. Nothing is written if the command has no
+// subcommands.
+func WriteSubcommands(w io.Writer, cmd *Command) error {
+	subcommands := cmd.Subcommands
+	if cmd.sortCommands() {
+		subcommands = make([]*Command, len(cmd.Subcommands))
+		copy(subcommands, cmd.Subcommands)
+		sort.SliceStable(subcommands, func(i, j int) bool {
+			return subcommands[i].Name < subcommands[j].Name
+		})
+	}
+	return detailSubcommands(w, subcommands, newHelpStyle(w, cmd))
+}
+
+// WriteEnvVars writes the section of a help message which lists the
+// environment variables from which the flags of a command and its ancestors
+// may be set to w. Nothing is written if there are none.
+func WriteEnvVars(w io.Writer, cmd *Command) error {
+	return detailEnvVars(w, cmd, newHelpStyle(w, cmd))
+}
+
+// detailFlagGroups prints each flag group of a command, followed by the flags
+// inherited from its ancestors.
+func detailFlagGroups(w io.Writer, cmd *Command, st helpStyle) error {
+	for _, group := range cmd.FlagGroups {
+		if cmd.sortFlags() {
+			group = sortedFlagGroup(group)
+		}
+		if err := detailFlagGroup(w, group, requiredMarker(cmd), st); err != nil {
+			return err
+		}
+	}
+	globalGroup := &FlagGroup{
+		Name:  "global",
+		Usage: "Global options",
+		Flags: cmd.InheritedFlags(),
+	}
+	if cmd.sortFlags() {
+		globalGroup = sortedFlagGroup(globalGroup)
+	}
+	return detailFlagGroup(w, globalGroup, RequiredNone, st)
+}
+
+// sortedFlagGroup returns a copy of group with its flags sorted by name.
+func sortedFlagGroup(group *FlagGroup) *FlagGroup {
+	g := *group
+	g.Flags = make([]*Flag, len(group.Flags))
+	copy(g.Flags, group.Flags)
+	sort.SliceStable(g.Flags, func(i, j int) bool {
+		return g.Flags[i].name() < g.Flags[j].name()
+	})
+	return &g
+}
+
+// FormatAll is a FormatFunc like Format that also shows hidden flags and
+// subcommands, marked as hidden. It is equivalent to the help message printed
+// by DefaultFormat, if it has not been reassigned, when the --help-all argument
+// is specified and the command has no custom FormatFunc.
+func FormatAll(w io.Writer, cmd *Command) error {
+	return Format(w, unhide(cmd))
+}
+
+// unhide returns a shallow copy of cmd in which all hidden flags and
+// subcommands are visible and marked as hidden.
+func unhide(cmd *Command) *Command {
+	c := *cmd
+	c.FlagGroups = make([]*FlagGroup, len(cmd.FlagGroups))
+	for i, group := range cmd.FlagGroups {
+		g := *group
+		g.Flags = make([]*Flag, len(group.Flags))
+		for j, flag := range group.Flags {
+			f := *flag
+			if f.Hidden {
+				f.Hidden = false
+				f.Usage = strings.TrimSpace(f.Usage + " (hidden)")
+			}
+			g.Flags[j] = &f
+		}
+		c.FlagGroups[i] = &g
+	}
+	c.Subcommands = make([]*Command, len(cmd.Subcommands))
+	for i, sub := range cmd.Subcommands {
+		s := *sub
+		if s.Hidden {
+			s.Hidden = false
+			s.Usage = strings.TrimSpace(s.Usage + " (hidden)")
+		}
+		c.Subcommands[i] = &s
+	}
+	return &c
+}
+
+// ColorMode specifies whether help messages are colored with ANSI escape
+// sequences.
+type ColorMode int
+
+// These constants specify when help messages are colored.
+const (
+	ColorAuto   ColorMode = iota + 1 // Color if the output is a terminal and NO_COLOR is not set (default).
+	ColorAlways                      // Always color help messages.
+	ColorNever                       // Never color help messages.
+)
+
+// helpStyle specifies how the details of a help message are laid out.
+type helpStyle struct {
+	width int
+	color bool
+}
+
+func newHelpStyle(w io.Writer, cmd *Command) helpStyle {
+	return helpStyle{width: helpWidth(w, cmd), color: useColor(w, cmd)}
+}
+
+// heading returns s in bold if color is enabled.
+func (st helpStyle) heading(s string) string {
+	if !st.color {
+		return s
+	}
+	return "\x1b[1m" + s + "\x1b[0m"
+}
+
+// dim returns s in faint text if color is enabled.
+func (st helpStyle) dim(s string) string {
+	if !st.color {
+		return s
+	}
+	return "\x1b[2m" + s + "\x1b[0m"
+}
+
+// useColor returns true if help messages for cmd are colored when written to
+// w. The mode specified by the command or its nearest ancestor is preferred.
+// Otherwise, help messages are colored only if w is a terminal and neither
+// NO_COLOR is set nor TERM is "dumb".
+func useColor(w io.Writer, cmd *Command) bool {
+	for p := cmd; p != nil; p = p.Parent {
+		switch p.ColorMode {
+		case ColorAlways:
+			return true
+		case ColorNever:
+			return false
+		}
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	if aw, ok := w.(*aggregatedWriter); ok {
+		w = aw.w
+	}
+	if f, ok := w.(*os.File); ok {
+		_, ok := terminalWidth(f.Fd())
+		return ok
+	}
+	return false
+}
+
+// helpWidth returns the width to which help messages for cmd are wrapped when
+// written to w. The width specified by the command or its nearest ancestor is
+// preferred, then the width of the terminal if w is a terminal, otherwise
+// defaultHelpWidth.
+func helpWidth(w io.Writer, cmd *Command) int {
+	for p := cmd; p != nil; p = p.Parent {
+		if p.HelpWidth > 0 {
+			return p.HelpWidth
+		}
+	}
+	if aw, ok := w.(*aggregatedWriter); ok {
+		w = aw.w
+	}
+	if f, ok := w.(*os.File); ok {
+		if n, ok := terminalWidth(f.Fd()); ok && n > 0 {
+			return n
+		}
+	}
+	return defaultHelpWidth
+}
+
+// textWidth returns the number of columns s occupies on a terminal, ignoring
+// ANSI escape sequences.
+func textWidth(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\x1b' && i+1 < len(s) && s[i+1] == '[' {
+			i += 2
+			for i < len(s) && (s[i] < 0x40 || s[i] > 0x7e) {
+				i++
+			}
+			continue
+		}
+		if utf8.RuneStart(s[i]) {
+			n++
+		}
+	}
+	return n
+}
+
+// wrapText breaks s into lines no longer than width at word boundaries. Line
+// breaks in s are preserved and words longer than width are not broken.
+func wrapText(s string, width int) []string {
+	lines := make([]string, 0, 4)
+	for _, paragraph := range strings.Split(s, "\n") {
+		if textWidth(paragraph) <= width {
+			lines = append(lines, paragraph)
+			continue
+		}
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			if line == "" {
+				line = word
+				continue
+			}
+			if textWidth(line)+1+textWidth(word) > width {
+				lines = append(lines, line)
+				line = word
+				continue
+			}
+			line += " " + word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// table aligns the columns of help messages using a tabwriter and wraps the
+// final column of each row, its description, to fit the help width.
+type table struct {
+	w     io.Writer
+	width int
+	buf   bytes.Buffer
+	tw    *tabwriter.Writer
+	descs []string
+}
+
+func newTable(w io.Writer, width, padding int) *table {
+	t := &table{w: w, width: width}
+	t.tw = tabwriter.NewWriter(&t.buf, 0, 0, padding, ' ', 0)
+	return t
+}
+
+// Row writes the tab separated cells of a row given by format, followed by the
+// description of the row.
+func (t *table) Row(desc, format string, a ...interface{}) {
+	fmt.Fprintf(t.tw, format+"\n", a...)
+	t.descs = append(t.descs, desc)
+}
+
+// Flush writes the aligned and wrapped table to the underlying writer.
+func (t *table) Flush() error {
+	if err := t.tw.Flush(); err != nil {
+		return err
+	}
+	if len(t.descs) == 0 {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(t.buf.String(), "\n"), "\n")
+	for i, line := range lines {
+		desc := t.descs[i]
+		indent := textWidth(line)
+		if t.width-indent < minHelpColumnWidth {
+			fmt.Fprintf(t.w, "%s%s\n", line, desc)
+			continue
+		}
+		for j, s := range wrapText(desc, t.width-indent) {
+			if j > 0 {
+				line = strings.Repeat(" ", indent)
+			}
+			if _, err := fmt.Fprintf(t.w, "%s%s\n", line, s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func getPositionals(cmd *Command) []*Flag {
 	a := make([]*Flag, 0, 8)
 	for _, group := range cmd.FlagGroups {
@@ -52,71 +392,175 @@ func getPositionals(cmd *Command) []*Flag {
 	return a
 }
 
+// hasRegular returns true if the command or any of its ancestors has a visible
+// regular flag that is optional. Required flags of the command itself are shown
+// separately in the usage line.
 func hasRegular(cmd *Command) bool {
-	if cmd == nil {
-		return false
+	for p := cmd; p != nil; p = p.Parent {
+		for _, group := range p.FlagGroups {
+			for _, flag := range group.Flags {
+				if flag.Hidden || flag.Positional || (p == cmd && flag.MinCount > 0) {
+					continue
+				}
+				return true
+			}
+		}
 	}
+	return false
+}
+
+// getRequired returns the visible, required regular flags of the command.
+func getRequired(cmd *Command) []*Flag {
+	a := make([]*Flag, 0)
 	for _, group := range cmd.FlagGroups {
-		for _, flag := range group.Flags {
-			if flag.Hidden || flag.Positional {
-				continue
+		for _, flag := range filterRegular(group.Flags) {
+			if flag.MinCount > 0 {
+				a = append(a, flag)
 			}
-			return true
 		}
 	}
-	return hasRegular(cmd.Parent)
+	return a
+}
+
+// requiredMarker returns the style in which required flags of the command are
+// marked in help messages.
+func requiredMarker(cmd *Command) RequiredMarker {
+	for p := cmd; p != nil; p = p.Parent {
+		if p.RequiredMarker != 0 {
+			return p.RequiredMarker
+		}
+	}
+	return RequiredText
 }
 
 func printUsage(w io.Writer, cmd *Command) error {
-	fullName := cmd.Name
+	if len(cmd.UsageLines) > 0 {
+		return printUsageLines(w, cmd)
+	}
+	for p := cmd; p != nil; p = p.Parent {
+		if p.UsageLineFunc != nil {
+			fmt.Fprintf(w, "%s\n", p.UsageLineFunc(cmd))
+			return nil
+		}
+	}
+	fmt.Fprintf(w, "%s %s", usagePrefix(cmd), fullName(cmd, " "))
+	if s := usageArgs(cmd); s != "" {
+		fmt.Fprintf(w, " %s", s)
+	}
+	fmt.Fprintf(w, "\n")
+	return nil
+}
+
+// printUsageLines prints the hand-written usage lines of a command. Lines
+// after the first are aligned with the first.
+func printUsageLines(w io.Writer, cmd *Command) error {
+	prefix := usagePrefix(cmd)
+	indent := strings.Repeat(" ", len(prefix))
+	for i, line := range cmd.UsageLines {
+		if i > 0 {
+			prefix = indent
+		}
+		fmt.Fprintf(w, "%s %s\n", prefix, line)
+	}
+	return nil
+}
+
+// usagePrefix returns the text printed before the usage line.
+func usagePrefix(cmd *Command) string {
+	for p := cmd; p != nil; p = p.Parent {
+		if p.UsagePrefix != "" {
+			return p.UsagePrefix
+		}
+	}
+	return "Usage:"
+}
+
+// fullName returns the names of the command and all of its ancestors, joined
+// by sep.
+func fullName(cmd *Command, sep string) string {
+	name := cmd.Name
 	for p := cmd.Parent; p != nil; p = p.Parent {
-		fullName = fmt.Sprintf("%s %s", p.Name, fullName)
+		name = p.Name + sep + name
+	}
+	return name
+}
+
+// usageArgs returns the arguments of the command as shown in the usage line.
+// E.g. "[OPTIONS] COMMAND".
+func usageArgs(cmd *Command) string {
+	a := make([]string, 0, 8)
+	for _, flag := range getRequired(cmd) {
+		s := flag.String()
+		if flag.ValueOptional {
+			s += "[=" + strings.ToUpper(flag.name()) + "]"
+		} else if !isBoolValue(flag.Value) {
+			s += " " + strings.ToUpper(flag.name())
+		}
+		a = append(a, s)
 	}
-	fmt.Fprintf(w, "Usage: %s", fullName)
 	if hasRegular(cmd) {
-		fmt.Fprintf(w, " [OPTIONS]")
+		a = append(a, "[OPTIONS]")
 	}
 	if len(cmd.Subcommands) > 0 {
-		fmt.Fprintf(w, " COMMAND")
+		a = append(a, "COMMAND")
 	}
 	for _, flag := range getPositionals(cmd) {
 		name := strings.ToUpper(flag.Name)
 		if flag.MinCount == 0 {
 			if flag.MaxCount == 1 {
-				fmt.Fprintf(w, " [%s]", name)
+				a = append(a, fmt.Sprintf("[%s]", name))
 			} else {
-				fmt.Fprintf(w, " [%s...]", name)
+				a = append(a, fmt.Sprintf("[%s...]", name))
 			}
 		} else {
 			if flag.MinCount == 1 && flag.MaxCount == 1 {
-				fmt.Fprintf(w, " %s", name)
+				a = append(a, name)
 			} else {
-				fmt.Fprintf(w, " %s...", name)
+				a = append(a, name+"...")
 			}
 		}
 	}
-	fmt.Fprintf(w, "\n")
-	return nil
+	return strings.Join(a, " ")
 }
 
-func detailPositionals(w io.Writer, cmd *Command) error {
+func detailPositionals(w io.Writer, cmd *Command, st helpStyle) error {
 	flags := getPositionals(cmd)
 	if len(flags) == 0 {
 		return nil
 	}
-	fmt.Fprintf(w, "\nPositional arguments:\n")
-	w = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "\n%s\n", st.heading("Positional arguments:"))
+	t := newTable(w, st.width, 2)
 	for _, flag := range flags {
-		fmt.Fprintf(w, "  %s", strings.ToUpper(flag.Name))
-		if flag.Usage != "" {
-			fmt.Fprintf(w, "\t%s", flag.Usage)
-			if flag.ShowDefault {
-				fmt.Fprintf(w, " (default: %s)", flag.Value)
-			}
+		name := strings.ToUpper(flag.Name)
+		if flag.Usage == "" {
+			t.Row("", "  %s", name)
+			continue
 		}
-		fmt.Fprintf(w, "\n")
+		desc := flag.Usage
+		if s := defaultString(flag); s != "" {
+			desc = fmt.Sprintf("%s %s", desc, st.dim("(default: "+s+")"))
+		}
+		t.Row(desc, "  %s\t", name)
+	}
+	return t.Flush()
+}
+
+// defaultString returns the default value of a flag to show in help messages
+// or an empty string if the default should not be shown.
+func defaultString(flag *Flag) string {
+	if !flag.ShowDefault {
+		return ""
+	}
+	var s string
+	if flag.DefaultFunc != nil {
+		s = flag.DefaultFunc()
+	} else if v, ok := flag.Value.(fmt.Stringer); ok {
+		s = v.String()
+	}
+	if flag.Sensitive && s != "" {
+		return redacted
 	}
-	return w.(*tabwriter.Writer).Flush()
+	return s
 }
 
 func filterRegular(flags []*Flag) []*Flag {
@@ -130,17 +574,25 @@ func filterRegular(flags []*Flag) []*Flag {
 	return a
 }
 
-func detailFlagGroup(w io.Writer, group *FlagGroup) error {
+func detailFlagGroup(w io.Writer, group *FlagGroup, marker RequiredMarker, st helpStyle) error {
 	flags := filterRegular(group.Flags)
 	if len(flags) == 0 {
 		return nil
 	}
-	fmt.Fprintf(w, "\n%s:\n", group.Usage)
-	w = tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(w, "\n%s\n", st.heading(group.Usage+":"))
+	t := newTable(w, st.width, 1)
 	for _, flag := range flags {
 		var name, shortName string
 		if flag.Name != "" {
 			name = fmt.Sprintf("--%s", flag.Name)
+			if flag.Negatable {
+				name = fmt.Sprintf("--[no-]%s", flag.Name)
+			}
+			if flag.ShowAliases {
+				for _, alias := range flag.Aliases {
+					name = fmt.Sprintf("%s, --%s", name, alias)
+				}
+			}
 		}
 		if flag.ShortName != "" {
 			if flag.Name != "" {
@@ -149,61 +601,97 @@ func detailFlagGroup(w io.Writer, group *FlagGroup) error {
 				shortName = fmt.Sprintf("-%s", flag.ShortName)
 			}
 		}
-		fmt.Fprintf(w, "  %s\t%s\t %s", shortName, name, flag.Usage)
-		if flag.ShowDefault {
-			fmt.Fprintf(w, " (default: %s)", flag.Value)
+		desc := flag.Usage
+		if s := defaultString(flag); s != "" {
+			desc = fmt.Sprintf("%s %s", desc, st.dim("(default: "+s+")"))
+		}
+		if flag.MinCount > 0 {
+			switch marker {
+			case RequiredText:
+				desc = strings.TrimSpace(desc + " (required)")
+			case RequiredAsterisk:
+				if flag.Name != "" {
+					name += "*"
+				} else {
+					shortName += "*"
+				}
+			}
+		}
+		if flag.Deprecated != "" {
+			desc = strings.TrimSpace(fmt.Sprintf("%s (deprecated: %s)", desc, flag.Deprecated))
 		}
-		fmt.Fprintf(w, "\n")
+		t.Row(desc, "  %s\t%s\t ", shortName, name)
 	}
-	return w.(*tabwriter.Writer).Flush()
+	return t.Flush()
 }
 
-func getEnvVars(a []*Flag, cmd *Command) []*Flag {
+// envVar is an environment variable from which a flag may be set.
+type envVar struct {
+	Name string
+	Flag *Flag
+}
+
+func getEnvVars(a []envVar, cmd *Command) []envVar {
 	if cmd == nil {
 		return a
 	}
 	a = getEnvVars(a, cmd.Parent)
 	for _, group := range cmd.FlagGroups {
 		for _, flag := range group.Flags {
-			if flag.EnvVar == "" || flag.Hidden {
+			name := envVarName(cmd, flag)
+			if name == "" || flag.Hidden {
 				continue
 			}
-			a = append(a, flag)
+			a = append(a, envVar{Name: name, Flag: flag})
 		}
 	}
 	return a
 }
 
-func detailEnvVars(w io.Writer, cmd *Command) error {
-	flags := getEnvVars(nil, cmd)
-	if len(flags) == 0 {
+func detailEnvVars(w io.Writer, cmd *Command, st helpStyle) error {
+	envVars := getEnvVars(nil, cmd)
+	if len(envVars) == 0 {
 		return nil
 	}
-	fmt.Fprintf(w, "\nEnvironment variables:\n")
-	w = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
-	for _, flag := range flags {
-		fmt.Fprintf(
-			w,
-			"  %s\t%s\n",
-			strings.ToUpper(flag.EnvVar),
-			flag.Usage,
-		)
+	// if a variable is declared more than once, the nearest command wins
+	index := make(map[string]int, len(envVars))
+	a := make([]envVar, 0, len(envVars))
+	for _, v := range envVars {
+		name := strings.ToUpper(v.Name)
+		if i, ok := index[name]; ok {
+			a[i] = v
+			continue
+		}
+		index[name] = len(a)
+		a = append(a, v)
 	}
-	return w.(*tabwriter.Writer).Flush()
+	fmt.Fprintf(w, "\n%s\n", st.heading("Environment variables:"))
+	t := newTable(w, st.width, 2)
+	for _, v := range a {
+		desc := v.Flag.Usage
+		if s := defaultString(v.Flag); s != "" {
+			desc = strings.TrimSpace(fmt.Sprintf("%s %s", desc, st.dim("(default: "+s+")")))
+		}
+		t.Row(desc, "  %s\t%s\t", strings.ToUpper(v.Name), v.Flag)
+	}
+	return t.Flush()
 }
 
-func detailSubcommands(w io.Writer, subcommands []*Command) error {
-	// TODO: wrap final column to terminal
+func detailSubcommands(w io.Writer, subcommands []*Command, st helpStyle) error {
 	if len(subcommands) == 0 {
 		return nil
 	}
-	fmt.Fprintf(w, "\nCommands:\n")
-	w = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "\n%s\n", st.heading("Commands:"))
+	t := newTable(w, st.width, 2)
 	for _, cmd := range subcommands {
 		if cmd.Hidden {
 			continue
 		}
-		fmt.Fprintf(w, "  %s\t%s\n", cmd.Name, cmd.Usage)
+		desc := cmd.Usage
+		if cmd.Deprecated != "" {
+			desc = strings.TrimSpace(fmt.Sprintf("%s (deprecated: %s)", desc, cmd.Deprecated))
+		}
+		t.Row(desc, "  %s\t", cmd.Name)
 	}
-	return w.(*tabwriter.Writer).Flush()
+	return t.Flush()
 }
@@ -0,0 +1,310 @@
+package xflags
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHelpWidth(t *testing.T) {
+	var name, region string
+	var force bool
+	var files []string
+	for _, width := range []int{40, 100} {
+		cmd := NewCommand("cloud", "Manage cloud applications").
+			HelpWidth(width).
+			Flags(
+				String(&region, "region", "us-east-1", "Region in which to manage applications").
+					ShowDefault(),
+			).
+			Subcommands(
+				NewCommand("deploy", "Deploy an application to the region, replacing the previous deployment").
+					Flags(
+						String(&name, "name", "", "Name of the application to deploy, which must be unique within the region").
+							ShortName("n").
+							Env("DEPLOY_NAME"),
+						Bool(&force, "force", false, "Replace any existing deployment"),
+						Strings(&files, "file", nil, "Files to include in the deployment\nrelative to the working directory").
+							Positional(),
+					),
+				NewCommand("rollback", "Roll back an application"),
+			).
+			Must()
+		w := &bytes.Buffer{}
+		if err := Format(w, cmd); err != nil {
+			t.Fatal(err)
+		}
+		if err := Format(w, cmd.Subcommands[0]); err != nil {
+			t.Fatal(err)
+		}
+		assertGolden(t, fmt.Sprintf("help-%d.txt", width), w.Bytes())
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	testCases := []struct {
+		s      string
+		width  int
+		expect []string
+	}{
+		{"", 10, []string{""}},
+		{"foo bar", 10, []string{"foo bar"}},
+		{"foo bar baz", 10, []string{"foo bar", "baz"}},
+		{"foo\nbar baz", 10, []string{"foo", "bar baz"}},
+		{"foobarbazqux quux", 10, []string{"foobarbazqux", "quux"}},
+	}
+	for _, testCase := range testCases {
+		assertStrings(t, testCase.expect, wrapText(testCase.s, testCase.width))
+	}
+}
+
+func TestRequiredMarker(t *testing.T) {
+	var token, region string
+	var verbose bool
+	testCases := map[RequiredMarker]string{
+		RequiredText:     "required-text.txt",
+		RequiredAsterisk: "required-asterisk.txt",
+		RequiredNone:     "required-none.txt",
+	}
+	for marker, golden := range testCases {
+		cmd := NewCommand("app", "").
+			RequiredMarker(marker).
+			Flags(
+				String(&token, "token", "", "API token").Required(),
+				String(&region, "region", "", "Region"),
+				Bool(&verbose, "v", false, "Verbose output").Required(),
+			).
+			Must()
+		w := &bytes.Buffer{}
+		if err := Format(w, cmd); err != nil {
+			t.Fatal(err)
+		}
+		assertGolden(t, golden, w.Bytes())
+	}
+}
+
+func TestSortFlagsAndCommands(t *testing.T) {
+	var a, b, c bool
+	for _, sorted := range []bool{false, true} {
+		builder := NewCommand("app", "").
+			Flags(
+				Bool(&c, "charlie", false, "Charlie"),
+				Bool(&a, "alpha", false, "Alpha"),
+				Bool(&b, "b", false, "Bravo"),
+			).
+			Subcommands(
+				NewCommand("zulu", "Zulu"),
+				NewCommand("yankee", "Yankee"),
+				NewCommand("xray", "X-ray"),
+			)
+		golden := "unsorted.txt"
+		if sorted {
+			builder = builder.SortFlags().SortCommands()
+			golden = "sorted.txt"
+		}
+		w := &bytes.Buffer{}
+		if err := Format(w, builder.Must()); err != nil {
+			t.Fatal(err)
+		}
+		assertGolden(t, golden, w.Bytes())
+	}
+}
+
+func TestShowDefaults(t *testing.T) {
+	var name, token, region string
+	var n int
+	var verbose bool
+	cmd := NewCommand("app", "").
+		ShowDefaults().
+		Flags(
+			String(&name, "name", "world", "Name to greet"),
+			Int(&n, "n", 1, "Number of greetings"),
+			Bool(&verbose, "verbose", false, "Print verbose output"),
+			String(&token, "token", "", "API token").Required(),
+		).
+		Subcommands(
+			NewCommand("deploy", "").
+				Flags(String(&region, "region", "us-east-1", "Region")),
+		).
+		Must()
+	w := &bytes.Buffer{}
+	if err := Format(w, cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := Format(w, cmd.Subcommands[0]); err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "show-defaults.txt", w.Bytes())
+}
+
+func TestEnvVarsHelp(t *testing.T) {
+	var region, deployRegion, token, name string
+	cmd := NewCommand("cloud", "").
+		Flags(
+			String(&region, "region", "us-east-1", "Region").Env("CLOUD_REGION").ShowDefault(),
+			String(&token, "token", "", "API token").Env("CLOUD_TOKEN"),
+		).
+		Subcommands(
+			NewCommand("deploy", "").
+				Flags(
+					String(&name, "name", "", "Application name").ShortName("n").Env("DEPLOY_NAME"),
+					String(&deployRegion, "deploy-region", "eu-west-1", "Deployment region").
+						Env("CLOUD_REGION").
+						ShowDefault(),
+				),
+		).
+		Must()
+	w := &bytes.Buffer{}
+	if err := cmd.Subcommands[0].WriteUsage(w); err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "env-vars.txt", w.Bytes())
+}
+
+func TestDefaultFormat(t *testing.T) {
+	defer func(f FormatFunc) { DefaultFormat = f }(DefaultFormat)
+	DefaultFormat = func(w io.Writer, cmd *Command) error {
+		_, err := fmt.Fprintf(w, "help for %s\n", fullName(cmd, " "))
+		return err
+	}
+	cmd := NewCommand("app", "").
+		Subcommands(
+			NewCommand("run", ""),
+			NewCommand("test", "").FormatFunc(Format),
+		).
+		Must()
+	for i, expect := range []string{
+		"help for app\n",
+		"help for app run\n",
+		"Usage: app test\n",
+	} {
+		c := cmd
+		if i > 0 {
+			c = cmd.Subcommands[i-1]
+		}
+		w := &bytes.Buffer{}
+		if err := c.WriteUsage(w); err != nil {
+			t.Fatal(err)
+		}
+		assertString(t, expect, w.String())
+	}
+}
+
+func TestColor(t *testing.T) {
+	var n int
+	var verbose bool
+	newCmd := func() *CommandBuilder {
+		return NewCommand("app", "").
+			Flags(
+				Int(&n, "count", 3, "Number of items").ShowDefault(),
+				Bool(&verbose, "verbose", false, "Verbose output"),
+			).
+			Subcommands(NewCommand("run", "Run the app"))
+	}
+
+	t.Run("Enabled", func(t *testing.T) {
+		cmd := newCmd().Color(true).Must()
+		w := &bytes.Buffer{}
+		if err := cmd.WriteUsage(w); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range []string{
+			"\n\x1b[1mOptions:\x1b[0m\n",
+			"\n\x1b[1mCommands:\x1b[0m\n",
+			"Number of items \x1b[2m(default: 3)\x1b[0m\n",
+		} {
+			if !strings.Contains(w.String(), s) {
+				t.Errorf("expected help message to contain %q, got:\n%s", s, w)
+			}
+		}
+	})
+
+	t.Run("Inherited", func(t *testing.T) {
+		cmd := newCmd().Color(true).Must()
+		w := &bytes.Buffer{}
+		if err := cmd.Subcommands[0].WriteUsage(w); err != nil {
+			t.Fatal(err)
+		}
+		if s := "\x1b[1mGlobal options:\x1b[0m"; !strings.Contains(w.String(), s) {
+			t.Errorf("expected help message to contain %q, got:\n%s", s, w)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		for _, cmd := range []*Command{newCmd().Must(), newCmd().Color(false).Must()} {
+			w := &bytes.Buffer{}
+			if err := cmd.WriteUsage(w); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(w.String(), "\x1b[") {
+				t.Errorf("expected no escape sequences, got:\n%q", w)
+			}
+		}
+	})
+
+	t.Run("NoColor", func(t *testing.T) {
+		os.Setenv("NO_COLOR", "1")
+		defer os.Unsetenv("NO_COLOR")
+		if useColor(os.Stdout, newCmd().Must()) {
+			t.Errorf("expected NO_COLOR to disable color")
+		}
+		if !useColor(os.Stdout, newCmd().Color(true).Must()) {
+			t.Errorf("expected Color(true) to override NO_COLOR")
+		}
+	})
+
+	t.Run("Wrap", func(t *testing.T) {
+		cmd := newCmd().Color(true).HelpWidth(44).Must()
+		w := &bytes.Buffer{}
+		if err := cmd.WriteUsage(w); err != nil {
+			t.Fatal(err)
+		}
+		s := "Number of items \x1b[2m(default: 3)\x1b[0m\n"
+		if !strings.Contains(w.String(), s) {
+			t.Errorf("expected escape sequences to be ignored when wrapping, got:\n%s", w)
+		}
+	})
+}
+
+func ExampleWriteFlagGroups() {
+	var verbose bool
+	var n int
+
+	// a minimal help message that lists commands before options and omits
+	// everything else
+	format := func(w io.Writer, cmd *Command) error {
+		if err := WriteUsageLine(w, cmd); err != nil {
+			return err
+		}
+		if err := WriteSubcommands(w, cmd); err != nil {
+			return err
+		}
+		return WriteFlagGroups(w, cmd)
+	}
+
+	cmd := NewCommand("app", "An example app").
+		FormatFunc(format).
+		Flags(
+			Bool(&verbose, "verbose", false, "Enable verbose output").ShortName("v"),
+			Int(&n, "count", 3, "Number of items").ShowDefault(),
+		).
+		Subcommands(
+			NewCommand("run", "Run the app"),
+			NewCommand("test", "Test the app"),
+		).
+		Must()
+	cmd.WriteUsage(os.Stdout)
+	// Output:
+	// Usage: app [OPTIONS] COMMAND
+	//
+	// Commands:
+	//   run   Run the app
+	//   test  Test the app
+	//
+	// Options:
+	//   -v, --verbose  Enable verbose output
+	//       --count    Number of items (default: 3)
+}
@@ -0,0 +1,95 @@
+package xflags
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// TemplateFuncs returns the functions available to help templates, in addition
+// to the builtin functions of text/template:
+//
+//     flagName FLAG         the names of a flag as shown in help messages. E.g. "-v, --verbose".
+//     defaultValue FLAG     the default value of a flag if it should be shown, or "".
+//     flags CMD             the visible regular flags of a command and its ancestors.
+//     positionals CMD       the visible positional arguments of a command.
+//     commands CMD          the visible subcommands of a command.
+//     usageLine CMD         the usage line of a command. E.g. "Usage: app [OPTIONS]".
+//     rpad S N              S padded with spaces to a width of N.
+//     upper S               S in upper case.
+//
+// The functions may be used to parse templates for TemplateFormatter.
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"flagName":     templateFlagName,
+		"defaultValue": defaultString,
+		"flags": func(cmd *Command) []*Flag {
+			a := make([]*Flag, 0)
+			for _, group := range cmd.FlagGroups {
+				a = append(a, filterRegular(group.Flags)...)
+			}
+			return append(a, filterRegular(cmd.InheritedFlags())...)
+		},
+		"positionals": getPositionals,
+		"commands": func(cmd *Command) []*Command {
+			a := make([]*Command, 0, len(cmd.Subcommands))
+			for _, sub := range cmd.Subcommands {
+				if !sub.Hidden {
+					a = append(a, sub)
+				}
+			}
+			return a
+		},
+		"usageLine": func(cmd *Command) (string, error) {
+			buf := &bytes.Buffer{}
+			if err := printUsage(buf, cmd); err != nil {
+				return "", err
+			}
+			return strings.TrimSuffix(buf.String(), "\n"), nil
+		},
+		"rpad": func(s string, n int) string {
+			if pad := n - utf8.RuneCountInString(s); pad > 0 {
+				return s + strings.Repeat(" ", pad)
+			}
+			return s
+		},
+		"upper": strings.ToUpper,
+	}
+}
+
+// templateFlagName returns the names of a flag as shown in help messages.
+func templateFlagName(flag *Flag) string {
+	if flag.Positional {
+		return strings.ToUpper(flag.name())
+	}
+	a := make([]string, 0, 2)
+	if flag.ShortName != "" {
+		a = append(a, "-"+flag.ShortName)
+	}
+	if flag.Name != "" {
+		if flag.Negatable {
+			a = append(a, "--[no-]"+flag.Name)
+		} else {
+			a = append(a, "--"+flag.Name)
+		}
+	}
+	return strings.Join(a, ", ")
+}
+
+// TemplateFormatter returns a FormatFunc that prints help messages by
+// executing tmpl with the command as its data. The template should be parsed
+// with the functions returned by TemplateFuncs.
+//
+//     tmpl := template.Must(template.New("help").Funcs(xflags.TemplateFuncs()).Parse(
+//         "{{usageLine .}}\n{{range flags .}}  {{rpad (flagName .) 16}}{{.Usage}}\n{{end}}",
+//     ))
+//     cmd := xflags.NewCommand("app", "").FormatFunc(xflags.TemplateFormatter(tmpl))
+//
+// See also CommandBuilder.HelpTemplate.
+func TemplateFormatter(tmpl *template.Template) FormatFunc {
+	return func(w io.Writer, cmd *Command) error {
+		return tmpl.Execute(w, cmd)
+	}
+}
@@ -0,0 +1,67 @@
+package xflags
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHelpTemplate(t *testing.T) {
+	var verbose, debug bool
+	var n int
+	var files []string
+	tmpl := `{{usageLine .}}
+{{.Usage}}
+{{range positionals .}}
+  {{rpad (flagName .) 16}}{{.Usage}}{{end}}
+{{range flags .}}
+  {{rpad (flagName .) 16}}{{.Usage}}{{with defaultValue .}} [{{.}}]{{end}}{{end}}
+{{range commands .}}
+  {{rpad .Name 16}}{{upper .Usage}}{{end}}
+`
+	cmd := NewCommand("app", "An example app").
+		HelpTemplate(tmpl).
+		Flags(
+			Bool(&verbose, "verbose", false, "Verbose output").ShortName("v"),
+			Bool(&debug, "debug", false, "Debug output").Hidden(),
+			Int(&n, "count", 3, "Number of items").ShowDefault(),
+		).
+		Subcommands(
+			NewCommand("run", "Run the app").
+				Flags(Strings(&files, "file", nil, "Files to run").Positional()),
+			NewCommand("secret", "").Hidden(),
+		).
+		Must()
+
+	w := &bytes.Buffer{}
+	if err := cmd.WriteUsage(w); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, `Usage: app [OPTIONS] COMMAND
+An example app
+
+
+  -v, --verbose   Verbose output
+  --count         Number of items [3]
+
+  run             RUN THE APP
+`, w.String())
+
+	// subcommands inherit the template
+	w.Reset()
+	if err := cmd.Subcommands[0].WriteUsage(w); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, `Usage: app run [OPTIONS] [FILE...]
+Run the app
+
+  FILE            Files to run
+
+  -v, --verbose   Verbose output
+  --count         Number of items [3]
+
+`, w.String())
+
+	if _, err := NewCommand("app", "").HelpTemplate("{{").Command(); err == nil {
+		t.Errorf("expected error for invalid template")
+	}
+}
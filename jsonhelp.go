@@ -0,0 +1,117 @@
+package xflags
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// jsonCommand is the machine-readable description of a command written by
+// FormatJSON.
+type jsonCommand struct {
+	Name        string         `json:"name"`
+	FullName    string         `json:"fullName"`
+	Usage       string         `json:"usage,omitempty"`
+	Synopsis    string         `json:"synopsis,omitempty"`
+	Version     string         `json:"version,omitempty"`
+	Deprecated  string         `json:"deprecated,omitempty"`
+	Positionals []*jsonFlag    `json:"positionals,omitempty"`
+	Flags       []*jsonFlag    `json:"flags,omitempty"`
+	Subcommands []*jsonCommand `json:"subcommands,omitempty"`
+}
+
+// jsonFlag is the machine-readable description of a flag written by
+// FormatJSON.
+type jsonFlag struct {
+	Name       string   `json:"name,omitempty"`
+	ShortName  string   `json:"shortName,omitempty"`
+	Aliases    []string `json:"aliases,omitempty"`
+	Group      string   `json:"group,omitempty"`
+	Usage      string   `json:"usage,omitempty"`
+	Default    string   `json:"default,omitempty"`
+	Required   bool     `json:"required,omitempty"`
+	Repeatable bool     `json:"repeatable,omitempty"`
+	Negatable  bool     `json:"negatable,omitempty"`
+	Env        string   `json:"env,omitempty"`
+	Choices    []string `json:"choices,omitempty"`
+	Deprecated string   `json:"deprecated,omitempty"`
+}
+
+// FormatJSON is a FormatFunc that writes a machine-readable description of a
+// command and all of its subcommands to w as JSON. The description includes
+// the flags and positional arguments of each command with their defaults,
+// environment variables and choices, for use by external tools such as
+// completion engines and documentation generators.
+//
+// Hidden flags and commands are omitted and the defaults of sensitive flags
+// are redacted. Flags inherited from ancestors are described only by the
+// command that declares them.
+func FormatJSON(w io.Writer, cmd *Command) error {
+	b, err := json.MarshalIndent(newJSONCommand(cmd), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// WriteHelpJSON writes a machine-readable description of this command to w.
+// See FormatJSON.
+func (c *Command) WriteHelpJSON(w io.Writer) error {
+	return FormatJSON(w, c)
+}
+
+func newJSONCommand(cmd *Command) *jsonCommand {
+	v := &jsonCommand{
+		Name:       cmd.Name,
+		FullName:   fullName(cmd, " "),
+		Usage:      cmd.Usage,
+		Synopsis:   cmd.Synopsis,
+		Version:    cmd.Version,
+		Deprecated: cmd.Deprecated,
+	}
+	for _, group := range cmd.FlagGroups {
+		for _, flag := range group.Flags {
+			if flag.Hidden {
+				continue
+			}
+			f := newJSONFlag(cmd, flag)
+			if flag.Positional {
+				v.Positionals = append(v.Positionals, f)
+				continue
+			}
+			f.Group = group.Name
+			v.Flags = append(v.Flags, f)
+		}
+	}
+	for _, sub := range cmd.Subcommands {
+		if !sub.Hidden {
+			v.Subcommands = append(v.Subcommands, newJSONCommand(sub))
+		}
+	}
+	return v
+}
+
+func newJSONFlag(cmd *Command, flag *Flag) *jsonFlag {
+	f := &jsonFlag{
+		Name:       flag.Name,
+		ShortName:  flag.ShortName,
+		Aliases:    flag.Aliases,
+		Usage:      flag.Usage,
+		Required:   flag.MinCount > 0,
+		Repeatable: flag.MaxCount != 1,
+		Negatable:  flag.Negatable,
+		Env:        envVarName(cmd, flag),
+		Choices:    flag.Choices,
+		Deprecated: flag.Deprecated,
+	}
+	if flag.DefaultFunc != nil {
+		f.Default = flag.DefaultFunc()
+	} else if s, ok := flag.Value.(fmt.Stringer); ok {
+		f.Default = s.String()
+	}
+	if flag.Sensitive && f.Default != "" {
+		f.Default = redacted
+	}
+	return f
+}
@@ -0,0 +1,14 @@
+package xflags
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteHelpJSON(t *testing.T) {
+	w := &bytes.Buffer{}
+	if err := newWidgetsCommand(nil).WriteHelpJSON(w); err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "widgets.json", w.Bytes())
+}
@@ -0,0 +1,171 @@
+package xflags
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteManPage writes a manual page for this command to w in troff format,
+// suitable for section 1 of the manual.
+//
+// The page is named after the command and all of its ancestors joined by "-".
+// E.g. "git-remote-add". Subcommands are listed under COMMANDS and referenced
+// under SEE ALSO so that a page may be generated for each command in the tree.
+// Hidden commands and flags are omitted.
+func (c *Command) WriteManPage(w io.Writer) error {
+	aw := newAggregatedWriter(w)
+	name := fullName(c, "-")
+	fmt.Fprintf(aw, ".TH %s 1", manEscape(strings.ToUpper(name)))
+	if version := c.version(); version != "" {
+		fmt.Fprintf(aw, " \"\" \"%s %s\"", manEscape(name), manEscape(version))
+	}
+	fmt.Fprintf(aw, "\n")
+
+	fmt.Fprintf(aw, ".SH NAME\n%s", manEscape(name))
+	if c.Usage != "" {
+		fmt.Fprintf(aw, " \\- %s", manEscape(c.Usage))
+	}
+	fmt.Fprintf(aw, "\n")
+
+	fmt.Fprintf(aw, ".SH SYNOPSIS\n.B %s\n", manEscape(fullName(c, " ")))
+	if s := usageArgs(c); s != "" {
+		fmt.Fprintf(aw, "%s\n", manEscape(s))
+	}
+
+	if c.Synopsis != "" {
+		fmt.Fprintf(aw, ".SH DESCRIPTION\n")
+		manParagraph(aw, c.Synopsis)
+	}
+
+	positionals := getPositionals(c)
+	inherited := filterRegular(c.InheritedFlags())
+	groups := make([]*FlagGroup, 0, len(c.FlagGroups)+1)
+	for _, group := range c.FlagGroups {
+		if len(filterRegular(group.Flags)) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	if len(positionals) > 0 || len(groups) > 0 || len(inherited) > 0 {
+		fmt.Fprintf(aw, ".SH OPTIONS\n")
+		for _, flag := range positionals {
+			manFlag(aw, flag, fmt.Sprintf("\\fI%s\\fR", manEscape(strings.ToUpper(flag.Name))))
+		}
+		for _, group := range groups {
+			if len(groups) > 1 || len(inherited) > 0 {
+				fmt.Fprintf(aw, ".SS %s\n", manEscape(group.Usage))
+			}
+			for _, flag := range filterRegular(group.Flags) {
+				manFlag(aw, flag, manFlagName(flag))
+			}
+		}
+		if len(inherited) > 0 {
+			fmt.Fprintf(aw, ".SS Global options\n")
+			for _, flag := range inherited {
+				manFlag(aw, flag, manFlagName(flag))
+			}
+		}
+	}
+
+	subcommands := make([]*Command, 0, len(c.Subcommands))
+	for _, sub := range c.Subcommands {
+		if !sub.Hidden {
+			subcommands = append(subcommands, sub)
+		}
+	}
+	if len(subcommands) > 0 {
+		fmt.Fprintf(aw, ".SH COMMANDS\n")
+		for _, sub := range subcommands {
+			fmt.Fprintf(aw, ".TP\n.B %s\n", manEscape(sub.Name))
+			manParagraph(aw, sub.Usage)
+		}
+	}
+
+	if envVars := getEnvVars(nil, c); len(envVars) > 0 {
+		fmt.Fprintf(aw, ".SH ENVIRONMENT\n")
+		for _, v := range envVars {
+			fmt.Fprintf(aw, ".TP\n.B %s\n", manEscape(strings.ToUpper(v.Name)))
+			manParagraph(aw, v.Flag.Usage)
+		}
+	}
+
+	refs := make([]string, 0, len(subcommands)+1)
+	if c.Parent != nil {
+		refs = append(refs, fullName(c.Parent, "-"))
+	}
+	for _, sub := range subcommands {
+		refs = append(refs, fullName(sub, "-"))
+	}
+	if len(refs) > 0 {
+		fmt.Fprintf(aw, ".SH SEE ALSO\n")
+		for i, ref := range refs {
+			fmt.Fprintf(aw, ".BR %s (1)", manEscape(ref))
+			if i < len(refs)-1 {
+				fmt.Fprintf(aw, " ,")
+			}
+			fmt.Fprintf(aw, "\n")
+		}
+	}
+	return aw.Err()
+}
+
+// manFlag writes a tagged paragraph describing a flag.
+func manFlag(w io.Writer, flag *Flag, tag string) {
+	fmt.Fprintf(w, ".TP\n%s\n", tag)
+	s := flag.Usage
+	if v := defaultString(flag); v != "" {
+		s = strings.TrimSpace(fmt.Sprintf("%s (default: %s)", s, v))
+	}
+	manParagraph(w, s)
+}
+
+// manParagraph writes s as escaped text followed by a newline. Nothing is
+// written if s is empty as blank lines are significant to troff.
+func manParagraph(w io.Writer, s string) {
+	if s == "" {
+		return
+	}
+	fmt.Fprintf(w, "%s\n", manText(s))
+}
+
+// manFlagName returns the bold names of a regular flag. E.g. "-l, --language".
+func manFlagName(flag *Flag) string {
+	a := make([]string, 0, 2+len(flag.Aliases))
+	if flag.ShortName != "" {
+		a = append(a, fmt.Sprintf("\\fB\\-%s\\fR", manEscape(flag.ShortName)))
+	}
+	if flag.Name != "" {
+		name := manEscape(flag.Name)
+		if flag.Negatable {
+			name = "[no\\-]" + name
+		}
+		a = append(a, fmt.Sprintf("\\fB\\-\\-%s\\fR", name))
+		if flag.ShowAliases {
+			for _, alias := range flag.Aliases {
+				a = append(a, fmt.Sprintf("\\fB\\-\\-%s\\fR", manEscape(alias)))
+			}
+		}
+	}
+	return strings.Join(a, ", ")
+}
+
+// manEscape escapes s so that it is printed literally by troff.
+func manEscape(s string) string {
+	s = strings.Replace(s, "\\", "\\e", -1)
+	s = strings.Replace(s, "-", "\\-", -1)
+	return s
+}
+
+// manText escapes a paragraph of text so that lines which start with a troff
+// control character are printed literally.
+func manText(s string) string {
+	lines := strings.Split(manEscape(s), "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			line = "\\&" + line
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,25 @@
+package xflags
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteManPage(t *testing.T) {
+	widgets := newWidgetsCommand(nil)
+	testCases := []struct {
+		golden string
+		cmd    *Command
+	}{
+		{"helloworld.1", App.Must()},
+		{"widgets.1", widgets},
+		{"widgets-create.1", widgets.Subcommands[0]},
+	}
+	for _, testCase := range testCases {
+		w := &bytes.Buffer{}
+		if err := testCase.cmd.WriteManPage(w); err != nil {
+			t.Fatal(err)
+		}
+		assertGolden(t, testCase.golden, w.Bytes())
+	}
+}
@@ -1,11 +1,17 @@
 package xflags
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// TODO: fuzz tests?
-
 // argument to terminate parsing of all remaining arguments
 const terminator = "--"
 
@@ -15,17 +21,26 @@ type argParser struct {
 	cmd               *Command
 	isTerminated      bool
 	flagsByName       map[string]*Flag
+	negatedByName     map[string]*Flag
 	subcommandsByName map[string]*Command
-	flagsSeen         map[string]int
+	flagsSeen         map[*Flag]int
+	envVars           map[*Flag]string
 	positionals       []*Flag
+	extraArgs         []string
+	unknownArgs       []string
+	stdinFlag         *Flag
+	foldCase          bool
+	lookupEnv         func(key string) (string, bool)
 }
 
 func newArgParser(cmd *Command, tokens []string) *argParser {
-	tokens = normalize(tokens, cmd.WithTerminator)
 	c := &argParser{
 		tokens:            tokens,
+		lookupEnv:         os.LookupEnv,
 		flagsByName:       make(map[string]*Flag),
-		flagsSeen:         make(map[string]int),
+		negatedByName:     make(map[string]*Flag),
+		flagsSeen:         make(map[*Flag]int),
+		envVars:           make(map[*Flag]string),
 		subcommandsByName: make(map[string]*Command),
 	}
 	c.setCommand(cmd)
@@ -33,17 +48,34 @@ func newArgParser(cmd *Command, tokens []string) *argParser {
 }
 
 // setCommand descends the parser into a new subcommand.
+//
+// Regular flags of all ancestors remain resolvable so that they may be
+// specified before or after the name of the subcommand, unless the subcommand
+// declares a flag of the same name. Positional flags of ancestors are no
+// longer accepted.
 func (c *argParser) setCommand(cmd *Command) {
 	// accumulate flags
 	c.cmd = cmd
 	c.positionals = make([]*Flag, 0)
+	if !c.foldCase && cmd.caseInsensitiveFlags() {
+		c.foldCase = true
+		c.flagsByName = c.foldKeys(c.flagsByName)
+		c.negatedByName = c.foldKeys(c.negatedByName)
+	}
 	for _, group := range cmd.FlagGroups {
 		for _, flag := range group.Flags {
-			if flag.Name != "" {
-				c.flagsByName["--"+flag.Name] = flag
+			for _, key := range flag.keys() {
+				c.flagsByName[c.fold(key)] = flag
+				if isDoubleDash(key) {
+					// shadow the negated form of an ancestor's flag
+					delete(c.negatedByName, c.fold("--no-"+key[2:]))
+				}
 			}
-			if flag.ShortName != "" {
-				c.flagsByName["-"+flag.ShortName] = flag
+			if flag.Negatable {
+				c.negatedByName[c.fold("--no-"+flag.Name)] = flag
+			}
+			if name := envVarName(cmd, flag); name != "" {
+				c.envVars[flag] = name
 			}
 			if flag.Positional {
 				c.positionals = append(c.positionals, flag)
@@ -58,7 +90,37 @@ func (c *argParser) setCommand(cmd *Command) {
 	}
 }
 
+// fold returns the key by which a flag is found in the parser's flag tables.
+// If flags are matched case-insensitively, long flag names are lowercased.
+// Short flag names are always case-sensitive.
+func (c *argParser) fold(key string) string {
+	if c.foldCase && isDoubleDash(key) {
+		return strings.ToLower(key)
+	}
+	return key
+}
+
+// foldKeys returns a copy of a flag table with all keys folded.
+func (c *argParser) foldKeys(m map[string]*Flag) map[string]*Flag {
+	folded := make(map[string]*Flag, len(m))
+	for key, flag := range m {
+		folded[c.fold(key)] = flag
+	}
+	return folded
+}
+
 func (c *argParser) Parse() (cmd *Command, args []string, err error) {
+	for p := c.cmd; p != nil; p = p.Parent {
+		if p.NormalizeFunc != nil {
+			c.tokens = p.NormalizeFunc(c.tokens)
+			break
+		}
+	}
+	if c.cmd.responseFiles() {
+		if c.tokens, err = c.expandResponseFiles(c.tokens, nil); err != nil {
+			return
+		}
+	}
 	for {
 		arg, ok := c.next()
 		if !ok {
@@ -68,45 +130,397 @@ func (c *argParser) Parse() (cmd *Command, args []string, err error) {
 			return
 		}
 	}
+	for c.descendDefault() {
+	}
+
+	// Flags are set from config files and environment variables before any
+	// constraints are checked so that they may satisfy required flags.
+	if err = c.parseConfigFile(); err != nil {
+		return
+	}
 	if err = c.parseEnvVars(); err != nil {
 		return
 	}
+	if err = c.parseDefaultFuncs(); err != nil {
+		return
+	}
+	if err = c.parseDefaultFlags(); err != nil {
+		return
+	}
 	if err = c.checkNArgs(); err != nil {
 		return
 	}
+	if err = c.checkRequiredTogether(); err != nil {
+		return
+	}
+	if err = c.validateArgs(); err != nil {
+		return
+	}
 	return c.cmd, c.args, nil
 }
 
-func (c *argParser) parseEnvVars() error {
-	for _, flag := range c.flagsByName {
-		if flag.EnvVar == "" {
+func (c *argParser) validateArgs() error {
+	if c.cmd.ArgsValidator == nil {
+		return nil
+	}
+	err := c.cmd.ArgsValidator(c.cmd, c.args)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*ArgumentError); ok {
+		return err
+	}
+	return wrapArgErr(err, c.cmd, nil, "")
+}
+
+// expandResponseFiles replaces each token of the form "@file" with the
+// whitespace separated arguments read from the file. Response files may
+// include other response files. Tokens starting with "@@" are unescaped to a
+// single "@" and no tokens are expanded after the terminator of the command.
+func (c *argParser) expandResponseFiles(tokens []string, stack []string) ([]string, error) {
+	a := make([]string, 0, len(tokens))
+	for i, token := range tokens {
+		if c.isTerminator(token) {
+			return append(a, tokens[i:]...), nil
+		}
+		if !strings.HasPrefix(token, "@") {
+			a = append(a, token)
 			continue
 		}
-		n := c.flagsSeen[flag.name()]
-		if n > 0 {
+		if strings.HasPrefix(token, "@@") {
+			a = append(a, token[1:])
 			continue
 		}
-		s, ok := os.LookupEnv(flag.EnvVar)
-		if !ok {
+		path := token[1:]
+		for _, s := range stack {
+			if s == path {
+				return nil, newArgErr(c.cmd, nil, token, "response file includes itself: %s", path)
+			}
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, wrapArgErr(err, c.cmd, nil, token)
+		}
+		args, err := SplitArgs(string(b))
+		if err != nil {
+			return nil, wrapArgErr(err, c.cmd, nil, token)
+		}
+		expanded, err := c.expandResponseFiles(args, append(stack, path))
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, expanded...)
+	}
+	return a, nil
+}
+
+// parseConfigFile sets any flags that were not specified on the command line
+// from the JSON config file named by the config file flag of the command or its
+// nearest ancestor that declares one.
+func (c *argParser) parseConfigFile() error {
+	var configFlag *Flag
+	for p := c.cmd; p != nil; p = p.Parent {
+		if p.ConfigFlag != "" {
+			configFlag = p.configFileFlag()
+			break
+		}
+	}
+	if configFlag == nil {
+		return nil
+	}
+	path := configFlag.Value.(fmt.Stringer).String()
+	if path == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return wrapArgErr(err, c.cmd, configFlag, path)
+	}
+	var config map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&config); err != nil {
+		return wrapArgErr(err, c.cmd, configFlag, path)
+	}
+
+	// set flags in a stable order
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		flag := c.flagsByName[c.fold("--"+key)]
+		if flag == nil {
+			return newArgErr(c.cmd, configFlag, path, "unrecognized key in config file %s: %s", path, key)
+		}
+		if c.flagsSeen[flag] > 0 {
 			continue
 		}
+		values, err := configValues(config[key])
+		if err != nil {
+			return newArgErr(c.cmd, flag, path, "invalid value for key in config file %s: %s: %v", path, key, err)
+		}
+		for _, value := range values {
+			c.observe(flag)
+			if err := c.setFlag(flag, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// configValues converts a value decoded from a JSON config file into the
+// command line arguments that set it. Arrays produce one argument per element.
+func configValues(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, nil
+	case json.Number:
+		return []string{v.String()}, nil
+	case bool:
+		return []string{strconv.FormatBool(v)}, nil
+	case []interface{}:
+		a := make([]string, 0, len(v))
+		for _, elem := range v {
+			if _, ok := elem.([]interface{}); ok {
+				return nil, fmt.Errorf("nested arrays are not supported")
+			}
+			values, err := configValues(elem)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, values...)
+		}
+		return a, nil
+	default:
+		return nil, fmt.Errorf("unsupported type: %T", v)
+	}
+}
+
+// parseEnvVars sets any flag of the invoked command and its ancestors that was
+// not otherwise specified from its environment variable. Flags are visited in
+// declaration order, starting with the invoked command, so that errors are
+// reported deterministically. Flags of commands that were not invoked are
+// ignored.
+func (c *argParser) parseEnvVars() error {
+	for p := c.cmd; p != nil; p = p.Parent {
+		for _, group := range p.FlagGroups {
+			for _, flag := range group.Flags {
+				if err := c.parseEnvVar(flag); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *argParser) parseEnvVar(flag *Flag) error {
+	name := c.envVars[flag]
+	if name == "" || c.flagsSeen[flag] > 0 {
+		return nil
+	}
+	s, ok := c.lookupEnv(name)
+	if !ok {
+		return nil
+	}
+	for _, value := range flag.envValues(s) {
 		c.observe(flag)
-		if err := c.setFlag(flag, s); err != nil {
+		if err := c.setFlag(flag, value); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// configValue returns the value of a flag in a form that may be marshaled to
+// JSON and read back from a config file. It returns false if the value of the
+// flag cannot be determined.
+func configValue(flag *Flag) (interface{}, bool) {
+	switch v := flag.Value.(type) {
+	case *countValue:
+		a := make([]bool, int(*v))
+		for i := range a {
+			a[i] = true
+		}
+		return a, true
+	case *bitFieldValue:
+		return *v.p&v.mask != 0, true
+	case *stringMapValue:
+		a := make([]string, 0, len(*v.p))
+		for key, value := range *v.p {
+			a = append(a, key+"="+value)
+		}
+		sort.Strings(a)
+		return a, true
+	case getter:
+		switch x := v.Get().(type) {
+		case bool, int, int64, uint, uint64, float64, string:
+			return x, true
+		case []string, []int, []int64, []uint64, []float64:
+			return x, true
+		case []time.Duration:
+			a := make([]string, len(x))
+			for i, d := range x {
+				a[i] = d.String()
+			}
+			return a, true
+		}
+	}
+	if s, ok := flag.Value.(fmt.Stringer); ok {
+		return s.String(), true
+	}
+	return nil, false
+}
+
+// parseDefaultFuncs sets the value of any flag that was not otherwise
+// specified to the result of its DefaultFunc. Flags set this way are not
+// considered seen.
+func (c *argParser) parseDefaultFuncs() error {
+	for p := c.cmd; p != nil; p = p.Parent {
+		for _, group := range p.FlagGroups {
+			for _, flag := range group.Flags {
+				if flag.DefaultFunc == nil || c.flagsSeen[flag] > 0 {
+					continue
+				}
+				if err := c.setFlag(flag, flag.DefaultFunc()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// parseDefaultFlags sets the value of any flag that was not otherwise specified
+// to the value of the flag named by its DefaultFrom field. Flags are resolved
+// after the flags they derive from. Flags set this way are not considered seen.
+func (c *argParser) parseDefaultFlags() error {
+	resolved := make(map[*Flag]bool)
+	var resolve func(cmd *Command, flag *Flag) error
+	resolve = func(cmd *Command, flag *Flag) error {
+		if resolved[flag] {
+			return nil
+		}
+		resolved[flag] = true
+		if flag.DefaultFrom == "" || c.flagsSeen[flag] > 0 {
+			return nil
+		}
+		source := cmd.Lookup(flag.DefaultFrom)
+		if source == nil {
+			return nil // checked when the command is built
+		}
+		if err := resolve(cmd, source); err != nil {
+			return err
+		}
+		s, ok := source.Value.(fmt.Stringer)
+		if !ok || s.String() == "" {
+			return nil
+		}
+		return c.setFlag(flag, s.String())
+	}
+	for p := c.cmd; p != nil; p = p.Parent {
+		for _, group := range p.FlagGroups {
+			for _, flag := range group.Flags {
+				if err := resolve(p, flag); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
 func (c *argParser) checkNArgs() error {
 	for _, group := range c.cmd.FlagGroups {
 		for _, flag := range group.Flags {
-			n := c.flagsSeen[flag.name()]
-			if flag.MinCount > 0 && n < flag.MinCount {
-				return newArgErr(c.cmd, flag, "", "missing argument: %s", flag)
+			if err := c.checkFlagNArgs(flag); err != nil {
+				return err
+			}
+		}
+	}
+	for _, flag := range c.cmd.InheritedFlags() {
+		if err := c.checkFlagNArgs(flag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkFlagNArgs checks that flag was seen at least MinCount and at most
+// MaxCount times.
+func (c *argParser) checkFlagNArgs(flag *Flag) error {
+	n := c.flagsSeen[flag]
+	if flag.MinCount > 0 && n < flag.MinCount {
+		if flag.MinCount > 1 && n > 0 {
+			return c.countErr(flag, n)
+		}
+		if name := c.envVars[flag]; name != "" {
+			return newArgErr(
+				c.cmd,
+				flag,
+				"",
+				"missing argument (or environment variable %s)",
+				name,
+			)
+		}
+		if flag.MinCount > 1 {
+			return c.countErr(flag, n)
+		}
+		return newArgErr(c.cmd, flag, "", "missing argument")
+	}
+	if flag.MaxCount > 0 && n > flag.MaxCount {
+		return c.countErr(flag, n)
+	}
+	return nil
+}
+
+// countErr returns an ArgumentError for a flag that was given n times, which
+// is outside the range allowed by the flag.
+func (c *argParser) countErr(flag *Flag, n int) error {
+	var expect string
+	switch {
+	case flag.MinCount == flag.MaxCount:
+		expect = fmt.Sprintf("%d", flag.MinCount)
+	case n < flag.MinCount:
+		expect = fmt.Sprintf("at least %d", flag.MinCount)
+	default:
+		expect = fmt.Sprintf("at most %d", flag.MaxCount)
+	}
+	noun := "arguments"
+	if expect == "1" || expect == "at most 1" {
+		noun = "argument"
+	}
+	return newArgErr(c.cmd, flag, "", "expected %s %s, got %d", expect, noun, n)
+}
+
+// checkRequiredTogether checks that either all or none of the flags in each
+// set of flags required together by the command or its ancestors were seen.
+func (c *argParser) checkRequiredTogether() error {
+	for p := c.cmd; p != nil; p = p.Parent {
+		for _, names := range p.RequiredTogether {
+			var seen string
+			missing := make([]string, 0, len(names))
+			for _, name := range names {
+				if c.flagsSeen[p.Lookup(name)] > 0 {
+					if seen == "" {
+						seen = "--" + name
+					}
+				} else {
+					missing = append(missing, "--"+name)
+				}
 			}
-			if flag.MaxCount > 0 && n > flag.MaxCount {
-				return newArgErr(c.cmd, flag, "", "argument declared too many times: %s", flag)
+			if seen != "" && len(missing) > 0 {
+				return newArgErr(
+					c.cmd,
+					nil,
+					"",
+					"missing arguments required with %s: %s",
+					seen,
+					strings.Join(missing, ", "),
+				)
 			}
 		}
 	}
@@ -131,8 +545,15 @@ func (c *argParser) next() (token string, ok bool) {
 }
 
 func (c *argParser) observe(flag *Flag) int {
-	c.flagsSeen[flag.name()] += 1
-	return c.flagsSeen[flag.name()]
+	c.flagsSeen[flag] += 1
+	return c.flagsSeen[flag]
+}
+
+// isTerminator returns true if token terminates parsing of the current
+// command's arguments.
+func (c *argParser) isTerminator(token string) bool {
+	t := c.cmd.terminatorToken()
+	return t != "" && token == t
 }
 
 func (c *argParser) dispatch(token string) error {
@@ -143,14 +564,11 @@ func (c *argParser) dispatch(token string) error {
 		c.args = append(c.args, token)
 		return nil
 	}
-	if token == terminator && c.cmd.WithTerminator {
+	if c.isTerminator(token) {
 		c.isTerminated = true
 		return nil
 	}
-	if token == "-h" || token == "--help" {
-		return &HelpError{Cmd: c.cmd}
-	}
-	if isPositional(token) {
+	if isPositional(token) || c.isNegativeNumber(token) {
 		return c.dispatchPositional(token)
 	}
 	return c.dispatchRegular(token)
@@ -159,44 +577,329 @@ func (c *argParser) dispatch(token string) error {
 func (c *argParser) dispatchPositional(token string) error {
 	// handle positional flag
 	if len(c.positionals) > 0 {
+		c.skipSatisfiedPositionals()
 		flag := c.positionals[0]
 		n := c.observe(flag)
 		if flag.MaxCount > 0 && n == flag.MaxCount {
 			// all done with this positional flag
 			c.positionals = c.positionals[1:]
 		}
-		return c.setFlag(flag, token)
+		return c.setArg(flag, token)
 	}
 
 	// handle subcommand
 	if len(c.cmd.Subcommands) == 0 {
+		if c.cmd.StopAtFirstPositional {
+			c.isTerminated = true
+			c.args = append(c.args, token)
+			return nil
+		}
+		if c.cmd.AllowExtraArgs {
+			c.extraArgs = append(c.extraArgs, token)
+			return nil
+		}
+		if c.cmd.ArgsValidator != nil {
+			c.args = append(c.args, token)
+			return nil
+		}
 		return newArgErr(c.cmd, nil, token, "unexpected positional argument: %s", token)
 	}
 	cmd, ok := c.subcommandsByName[token]
 	if !ok {
-		return newArgErr(c.cmd, nil, token, "unrecognized command: %s", token)
+		if c.descendDefault() {
+			return c.dispatch(token)
+		}
+		names := make([]string, 0, len(c.cmd.Subcommands))
+		for _, cmd := range c.cmd.Subcommands {
+			if !cmd.Hidden {
+				names = append(names, cmd.Name)
+			}
+		}
+		return c.unrecognized("command", token, names)
 	}
-	c.setCommand(cmd)
+	c.descend(cmd)
 	return nil
 }
 
+// skipSatisfiedPositionals advances past positional flags that have received
+// their minimum number of arguments if the remaining positional arguments on
+// the command line, including the current one, are needed to satisfy the
+// minimum of the positional flags that follow. This allows an optional or
+// variable length positional flag to be followed by required positional flags.
+func (c *argParser) skipSatisfiedPositionals() {
+	remaining := 1 + c.countPositionalTokens()
+	for len(c.positionals) > 1 {
+		flag := c.positionals[0]
+		if c.flagsSeen[flag] < flag.MinCount {
+			return
+		}
+		reserved := 0
+		for _, next := range c.positionals[1:] {
+			reserved += next.MinCount
+		}
+		if remaining > reserved {
+			return
+		}
+		c.positionals = c.positionals[1:]
+	}
+}
+
+// countPositionalTokens returns the number of unparsed tokens that will be
+// parsed as positional arguments, excluding the values of flags given as a
+// separate argument and anything after the terminator.
+func (c *argParser) countPositionalTokens() int {
+	n := 0
+	for i := 0; i < len(c.tokens); i++ {
+		token := c.tokens[i]
+		if c.isTerminator(token) {
+			break
+		}
+		if isPositional(token) || c.isNegativeNumber(token) {
+			n++
+			continue
+		}
+		name, _, hasValue := splitArg(token)
+		flag := c.flagsByName[c.fold(name)]
+		if flag != nil && !hasValue && !isBoolValue(flag.Value) && !flag.ValueOptional {
+			i++ // skip the value
+		}
+	}
+	return n
+}
+
+// descend descends the parser into a subcommand specified on the command line.
+func (c *argParser) descend(cmd *Command) {
+	c.setCommand(cmd)
+	if cmd.Deprecated != "" {
+		c.warnf("command %s is deprecated: %s", cmd.Name, cmd.Deprecated)
+	}
+}
+
+// descendDefault descends the parser into the default subcommand of the
+// current command. It returns false if the command has no default subcommand.
+func (c *argParser) descendDefault() bool {
+	cmd := c.subcommandsByName[c.cmd.DefaultSubcommand]
+	if cmd == nil {
+		return false
+	}
+	c.descend(cmd)
+	return true
+}
+
 func (c *argParser) dispatchRegular(token string) error {
+	name, value, hasValue := splitArg(token)
+	if name == "--" || name == "-=" || strings.HasPrefix(name, "---") {
+		return newArgErr(c.cmd, nil, token, "invalid argument: %s", token)
+	}
+	key := c.fold(name)
+	if key == "-h" || key == "--help" {
+		return &HelpError{Cmd: c.cmd}
+	}
+	if key == "--help-all" && c.flagsByName[key] == nil {
+		return &HelpError{Cmd: c.cmd, ShowHidden: true}
+	}
+	if (key == "--version" || key == "-V") && c.flagsByName[key] == nil && c.cmd.version() != "" {
+		return c.dispatchVersion()
+	}
+
 	// regular flag
-	flag := c.flagsByName[token]
+	flag, negated := c.flagsByName[key], false
 	if flag == nil {
-		return newArgErr(c.cmd, nil, token, "unrecognized argument: %s", token)
+		flag = c.negatedByName[key]
+		negated = flag != nil
+	}
+	if flag == nil && isDoubleDash(key) && c.cmd.allowAbbreviations() {
+		var err error
+		if flag, negated, err = c.expandAbbreviation(name, key); err != nil {
+			return err
+		}
+	}
+	if flag == nil {
+		if c.descendDefault() {
+			return c.dispatchRegular(token)
+		}
+		if c.cmd.ignoreUnknownFlags() {
+			c.unknownArgs = append(c.unknownArgs, token)
+			return nil
+		}
+		names := make([]string, 0, len(c.flagsByName)+len(c.negatedByName))
+		for key, flag := range c.flagsByName {
+			if !flag.Hidden {
+				names = append(names, key)
+			}
+		}
+		for key, flag := range c.negatedByName {
+			if !flag.Hidden {
+				names = append(names, key)
+			}
+		}
+		return wrapArgErr(&UnknownFlagError{
+			Cmd:        c.cmd,
+			Arg:        name,
+			Suggestion: suggest(name, names),
+		}, c.cmd, nil, name)
+	}
+	c.warnDeprecated(flag, name)
+	if negated {
+		return c.dispatchNegated(flag, name, hasValue)
 	}
 	c.observe(flag)
+	if hasValue && isBoolValue(flag.Value) && isSingleDash(token) && token[2] != '=' {
+		// expand combined boolean short flags. E.g. -abc is -a -b -c.
+		if value[0] == '-' {
+			return newArgErr(c.cmd, nil, token, "unrecognized argument: %s", token)
+		}
+		if err := c.setFlag(flag, "true"); err != nil {
+			return err
+		}
+		return c.dispatchRegular("-" + value)
+	}
+	if hasValue && value == "" {
+		// only permit empty values for flags that accept them, like strings
+		if err := flag.Set(""); err != nil {
+			return newArgErr(c.cmd, flag, name, "no value specified for flag: %s", name)
+		}
+		return nil
+	}
+	if hasValue {
+		return c.setArg(flag, value)
+	}
 	if isBoolValue(flag.Value) {
 		return c.setFlag(flag, "true")
 	}
+	if flag.ValueOptional {
+		return c.setFlag(flag, flag.BareValue)
+	}
 
 	// read the next arg as a value
 	value, ok := c.peek()
-	if !ok || !isPositional(value) {
-		return newArgErr(c.cmd, flag, token, "no value specified for flag: %s", token)
+	if !ok || !(isPositional(value) || c.isNegativeNumber(value)) {
+		if ok && !c.isFlag(value) && !c.isTerminator(value) {
+			// values that start with "-" must be given with "="
+			if flag.Sensitive {
+				value = "VALUE"
+			}
+			return newArgErr(
+				c.cmd,
+				flag,
+				name,
+				"no value specified for flag: %s (use %s=%s to specify a value that starts with \"-\")",
+				name,
+				name,
+				value,
+			)
+		}
+		return newArgErr(c.cmd, flag, name, "no value specified for flag: %s", name)
 	}
 	c.next() // consume the value
+	return c.setArg(flag, value)
+}
+
+// expandAbbreviation returns the flag whose long name, or negated long name,
+// starts with the given key if exactly one such flag exists. If more than one
+// flag matches, an ArgumentError listing the candidates is returned.
+func (c *argParser) expandAbbreviation(name, key string) (flag *Flag, negated bool, err error) {
+	candidates := make([]string, 0)
+	ambiguous := false
+	match := func(m map[string]*Flag, isNegated bool) {
+		for k, f := range m {
+			if !strings.HasPrefix(k, key) || !isDoubleDash(k) {
+				continue
+			}
+			candidates = append(candidates, k)
+			if flag == nil || (flag == f && negated == isNegated) {
+				flag, negated = f, isNegated
+				continue
+			}
+			ambiguous = true
+		}
+	}
+	match(c.flagsByName, false)
+	match(c.negatedByName, true)
+	if ambiguous {
+		sort.Strings(candidates)
+		return nil, false, newArgErr(
+			c.cmd,
+			nil,
+			name,
+			"ambiguous argument: %s, could be: %s",
+			name,
+			strings.Join(candidates, ", "),
+		)
+	}
+	return flag, negated, nil
+}
+
+// unrecognized returns an ArgumentError for an unrecognized token which
+// suggests the most similar of the given names if one is likely intended.
+func (c *argParser) unrecognized(kind, token string, names []string) error {
+	if s := suggest(token, names); s != "" {
+		return newArgErr(
+			c.cmd,
+			nil,
+			token,
+			"unrecognized %s: %s, did you mean %q?",
+			kind,
+			token,
+			s,
+		)
+	}
+	return newArgErr(c.cmd, nil, token, "unrecognized %s: %s", kind, token)
+}
+
+// warnDeprecated prints a warning if the given flag, specified on the command
+// line as name, is deprecated.
+func (c *argParser) warnDeprecated(flag *Flag, name string) {
+	if flag.Deprecated == "" {
+		return
+	}
+	c.warnf("%s is deprecated: %s", name, flag.Deprecated)
+}
+
+// warnf prints a warning to the standard error of the current command.
+func (c *argParser) warnf(format string, a ...interface{}) {
+	_, stderr := c.cmd.output()
+	fmt.Fprintf(stderr, "Warning: "+format+"\n", a...)
+}
+
+func (c *argParser) dispatchNegated(flag *Flag, name string, hasValue bool) error {
+	if hasValue {
+		return newArgErr(c.cmd, flag, name, "negated flag does not accept a value: %s", name)
+	}
+	c.observe(flag)
+	return c.setFlag(flag, "false")
+}
+
+func (c *argParser) dispatchVersion() error {
+	if c.cmd.versionCommand().VersionExits {
+		return &VersionError{Cmd: c.cmd}
+	}
+	stdout, _ := c.cmd.output()
+	_, err := fmt.Fprintln(stdout, c.cmd.version())
+	return err
+}
+
+// setArg sets a flag to a value given on the command line. If the flag allows
+// it, the value "-" is replaced with the contents of standard input.
+func (c *argParser) setArg(flag *Flag, value string) error {
+	if flag.AllowStdin && value == "-" {
+		if c.stdinFlag != nil {
+			return newArgErr(
+				c.cmd,
+				flag,
+				value,
+				"standard input was already read by %s",
+				c.stdinFlag,
+			)
+		}
+		c.stdinFlag = flag
+		b, err := ioutil.ReadAll(c.cmd.input())
+		if err != nil {
+			return wrapArgErr(err, c.cmd, flag, value)
+		}
+		value = strings.TrimSuffix(string(b), "\n")
+		value = strings.TrimSuffix(value, "\r")
+	}
 	return c.setFlag(flag, value)
 }
 
@@ -207,6 +910,46 @@ func (c *argParser) setFlag(flag *Flag, value string) error {
 	return nil
 }
 
+// isFlag returns true if arg is the name of a flag of the current command,
+// with or without a value.
+func (c *argParser) isFlag(arg string) bool {
+	key, _, _ := splitArg(arg)
+	key = c.fold(key)
+	if c.flagsByName[key] != nil || c.negatedByName[key] != nil {
+		return true
+	}
+	switch key {
+	case "-h", "--help", "--help-all", "--version", "-V":
+		return true
+	}
+	return false
+}
+
+// isNegativeNumber returns true if arg is a negative number that is not also
+// the name of a flag, so that it may be consumed as the value of a flag or as
+// a positional argument. The dash must be followed by a digit, or a decimal
+// point and a digit, so that words such as "-inf" are not numbers.
+func (c *argParser) isNegativeNumber(arg string) bool {
+	if len(arg) < 2 || arg[0] != '-' {
+		return false
+	}
+	digits := arg[1:]
+	if digits[0] == '.' {
+		digits = digits[1:]
+	}
+	if len(digits) == 0 || digits[0] < '0' || digits[0] > '9' {
+		return false
+	}
+	if name, _, _ := splitArg(arg); c.flagsByName[c.fold(name)] != nil {
+		return false
+	}
+	if _, err := parseInt(arg, 64); err == nil {
+		return true
+	}
+	_, err := strconv.ParseFloat(arg, 64)
+	return err == nil
+}
+
 func isSingleDash(arg string) bool {
 	if len(arg) < 2 {
 		return false
@@ -225,35 +968,110 @@ func isPositional(arg string) bool {
 	return !isSingleDash(arg) && !isDoubleDash(arg)
 }
 
-// normalize splits any arguments that declare both a key and a value (E.g.
-// --key=value, or -kV) into two distinct arguments.
-func normalize(args []string, withTerminator bool) []string {
-	out := make([]string, 0, len(args))
-	for i, arg := range args {
-		if withTerminator && arg == terminator {
-			out = append(out, args[i:]...)
-			return out
-		}
-		if isSingleDash(arg) {
-			out = append(out, arg[:2])
-			arg = arg[2:]
-			if len(arg) > 0 {
-				if arg[0] == '=' {
-					arg = arg[1:]
-				}
-			} else {
-				continue
+// splitArg splits an argument that declares both a key and a value (E.g.
+// --key=value, or -kV) into its key and value. If the argument declares no
+// value, hasValue is false.
+func splitArg(arg string) (key, value string, hasValue bool) {
+	if isSingleDash(arg) {
+		if len(arg) == 2 {
+			return arg, "", false
+		}
+		value = arg[2:]
+		if value[0] == '=' {
+			value = value[1:]
+		}
+		return arg[:2], value, true
+	}
+	if isDoubleDash(arg) {
+		for i := 2; i < len(arg); i++ {
+			if arg[i] == '=' {
+				return arg[:i], arg[i+1:], true
+			}
+		}
+	}
+	return arg, "", false
+}
+
+// SplitArgs splits s into arguments separated by unquoted whitespace, in the
+// manner of a POSIX shell, so that arguments stored in a file or string may be
+// passed to Command.Parse. E.g.
+//
+//     --name "my widget" --label 'a=b' --note it\'s
+//
+// is split into "--name", "my widget", "--label", "a=b", "--note" and "it's".
+//
+// Characters enclosed in single quotes are preserved literally. Within double
+// quotes, a backslash escapes only '"', '\', '$', '`' and newline. Elsewhere, a
+// backslash preserves the literal value of the next character. A backslash
+// followed by a newline is removed entirely. A '#' at the start of an argument
+// begins a comment that continues to the end of the line. No variables,
+// wildcards or other expansions are performed.
+//
+// An error is returned if a quote is not terminated or the input ends with an
+// unquoted backslash.
+func SplitArgs(s string) ([]string, error) {
+	args := make([]string, 0)
+	var sb strings.Builder
+	inArg := false
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			if inArg {
+				args = append(args, sb.String())
+				sb.Reset()
+				inArg = false
+			}
+		case ch == '#' && !inArg:
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case ch == '\\':
+			i++
+			if i == len(s) {
+				return nil, errorf("unterminated escape at end of input")
+			}
+			if s[i] == '\n' {
+				continue // line continuation
 			}
-		} else if isDoubleDash(arg) {
-			for i := 3; i < len(arg); i++ {
-				if arg[i] == '=' {
-					out = append(out, arg[:i])
-					arg = arg[i+1:]
+			sb.WriteByte(s[i])
+			inArg = true
+		case ch == '\'':
+			j := strings.IndexByte(s[i+1:], '\'')
+			if j < 0 {
+				return nil, errorf("unterminated quote: %s", s[i:])
+			}
+			sb.WriteString(s[i+1 : i+1+j])
+			i += 1 + j
+			inArg = true
+		case ch == '"':
+			start := i
+			for i++; ; i++ {
+				if i == len(s) {
+					return nil, errorf("unterminated quote: %s", s[start:])
+				}
+				if s[i] == '"' {
 					break
 				}
+				if s[i] == '\\' && i+1 < len(s) {
+					switch s[i+1] {
+					case '"', '\\', '$', '`':
+						i++
+					case '\n':
+						i++
+						continue
+					}
+				}
+				sb.WriteByte(s[i])
 			}
+			inArg = true
+		default:
+			sb.WriteByte(ch)
+			inArg = true
 		}
-		out = append(out, arg)
 	}
-	return out
+	if inArg {
+		args = append(args, sb.String())
+	}
+	return args, nil
 }
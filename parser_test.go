@@ -1,45 +1,514 @@
 package xflags
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
 	"testing"
+	"time"
 )
 
-func TestNormalize(t *testing.T) {
-	args := []string{
-		"-x", "-xVar", "-x=Var", "-x=",
-		"--x", "--xVar", "--x=Var", "--x=",
-		"--foo", "--foo=bar", "--foo=",
-		"", "-", "--",
-	}
-	expect := []string{
-		"-x", "-x", "Var", "-x", "Var", "-x", "",
-		"--x", "--xVar", "--x", "Var", "--x", "",
-		"--foo", "--foo", "bar", "--foo", "",
-		"", "-", "--",
-	}
-	t.Run("NoTerminator", func(t *testing.T) {
-		actual := normalize(args, false)
-		if len(actual) != len(expect) {
-			t.Errorf("expected %q, got %q", expect, actual)
-			return
-		}
-		for i := 0; i < len(expect); i++ {
-			if expect[i] != actual[i] {
-				t.Errorf("expected %q, got %q", expect, actual)
-				return
+func TestSplitArg(t *testing.T) {
+	testCases := []struct {
+		arg      string
+		key      string
+		value    string
+		hasValue bool
+	}{
+		{"-x", "-x", "", false},
+		{"-xVar", "-x", "Var", true},
+		{"-x=Var", "-x", "Var", true},
+		{"-x=", "-x", "", true},
+		{"--x", "--x", "", false},
+		{"--xVar", "--xVar", "", false},
+		{"--x=Var", "--x", "Var", true},
+		{"--x=", "--x", "", true},
+		{"--foo", "--foo", "", false},
+		{"--foo=bar", "--foo", "bar", true},
+		{"--foo=", "--foo", "", true},
+		{"--foo=bar=baz", "--foo", "bar=baz", true},
+		{"--=", "--", "", true},
+		{"--=foo", "--", "foo", true},
+		{"-=", "-=", "", false},
+		{"-=foo", "-=", "foo", true},
+		{"", "", "", false},
+		{"-", "-", "", false},
+		{"--", "--", "", false},
+	}
+	for _, testCase := range testCases {
+		key, value, hasValue := splitArg(testCase.arg)
+		if key != testCase.key ||
+			value != testCase.value ||
+			hasValue != testCase.hasValue {
+			t.Errorf(
+				"%q: expected (%q, %q, %v), got (%q, %q, %v)",
+				testCase.arg,
+				testCase.key, testCase.value, testCase.hasValue,
+				key, value, hasValue,
+			)
+		}
+	}
+}
+
+func TestMalformedArgs(t *testing.T) {
+	var a bool
+	cmd := NewCommand("test", "").
+		Flags(Bool(&a, "a", false, "")).
+		Must()
+	for _, arg := range []string{"--=", "--=value", "-=", "-=a", "---a", "---a=true"} {
+		_, err := cmd.Parse([]string{arg})
+		var argErr *ArgumentError
+		if assertErrorAs(t, err, &argErr) {
+			assertString(t, "invalid argument: "+arg, argErr.Text)
+		}
+	}
+}
+
+func TestEmptyValues(t *testing.T) {
+	var name string
+	var count int
+	var verbose bool
+	var tags []string
+	newCommand := func() *Command {
+		name, count, verbose, tags = "default", 1, true, nil
+		return NewCommand("test", "").
+			Flags(
+				String(&name, "name", "default", ""),
+				Int(&count, "count", 1, "").ShortName("c"),
+				Bool(&verbose, "verbose", true, ""),
+				Strings(&tags, "tag", nil, ""),
+			).
+			Must()
+	}
+
+	_, err := newCommand().Parse([]string{"--name=", "--tag="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "", name)
+	assertStrings(t, []string{""}, tags)
+
+	for _, arg := range []string{"--count=", "-c=", "--verbose="} {
+		_, err := newCommand().Parse([]string{arg})
+		var argErr *ArgumentError
+		if assertErrorAs(t, err, &argErr) {
+			flagName := strings.TrimSuffix(arg, "=")
+			assertString(t, "no value specified for flag: "+flagName, argErr.Text)
+		}
+		assertInt64(t, 1, int64(count))
+		assertBool(t, true, verbose)
+	}
+}
+
+func TestPositionalAllocation(t *testing.T) {
+	var a, b, c []string
+	newCommand := func(flags ...Flagger) *Command {
+		a, b, c = nil, nil, nil
+		return NewCommand("test", "").Flags(flags...).Must()
+	}
+	var verbose bool
+	var name string
+	tests := []struct {
+		cmd     func() *Command
+		args    []string
+		a, b, c []string
+		err     bool
+	}{
+		{
+			cmd: func() *Command {
+				return newCommand(
+					Strings(&a, "a", nil, "").Positional().NArgs(1, 1),
+					Strings(&b, "b", nil, "").Positional().NArgs(0, 0),
+				)
+			},
+			args: []string{"1", "2", "3"},
+			a:    []string{"1"},
+			b:    []string{"2", "3"},
+		},
+		{
+			cmd: func() *Command {
+				return newCommand(
+					Strings(&a, "a", nil, "").Positional().NArgs(0, 1),
+					Strings(&b, "b", nil, "").Positional().NArgs(1, 1),
+				)
+			},
+			args: []string{"1"},
+			b:    []string{"1"},
+		},
+		{
+			cmd: func() *Command {
+				return newCommand(
+					Strings(&a, "a", nil, "").Positional().NArgs(1, 2),
+					Strings(&b, "b", nil, "").Positional().NArgs(2, 2),
+					Strings(&c, "c", nil, "").Positional().NArgs(0, 0),
+				)
+			},
+			args: []string{"1", "2", "3"},
+			a:    []string{"1"},
+			b:    []string{"2", "3"},
+		},
+		{
+			cmd: func() *Command {
+				return newCommand(
+					Bool(&verbose, "verbose", false, "").ShortName("v"),
+					String(&name, "name", "", ""),
+					Strings(&a, "a", nil, "").Positional().NArgs(1, 2),
+					Strings(&b, "b", nil, "").Positional().NArgs(1, 1),
+				)
+			},
+			args: []string{"1", "-v", "--name", "foo", "2"},
+			a:    []string{"1"},
+			b:    []string{"2"},
+		},
+		{
+			cmd: func() *Command {
+				return newCommand(
+					Strings(&a, "a", nil, "").Positional().NArgs(2, 2),
+					Strings(&b, "b", nil, "").Positional().NArgs(1, 1),
+				)
+			},
+			args: []string{"1", "2"},
+			a:    []string{"1", "2"},
+			err:  true,
+		},
+		{
+			cmd: func() *Command {
+				return newCommand(
+					Strings(&a, "a", nil, "").Positional().NArgs(1, 1),
+					Strings(&b, "b", nil, "").Positional().NArgs(1, 1),
+				)
+			},
+			args: []string{"1", "2", "3"},
+			a:    []string{"1"},
+			b:    []string{"2"},
+			err:  true,
+		},
+	}
+	for i, test := range tests {
+		_, err := test.cmd().Parse(test.args)
+		if test.err {
+			assertErrorAs(t, err, new(*ArgumentError))
+		} else if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		assertStrings(t, test.a, a)
+		assertStrings(t, test.b, b)
+		assertStrings(t, test.c, c)
+	}
+}
+
+func TestArgCountErrors(t *testing.T) {
+	var name string
+	var tags, files []string
+	newCommand := func() *Command {
+		return NewCommand("test", "").
+			Flags(
+				String(&name, "name", "", ""),
+				Strings(&tags, "tag", nil, "").NArgs(2, 3),
+				Strings(&files, "file", nil, "").Positional().NArgs(2, 2),
+			).
+			Must()
+	}
+	tests := []struct {
+		args   []string
+		expect string
+	}{
+		{[]string{"a", "b", "--name=x", "--name=y"}, "--name: expected at most 1 argument, got 2"},
+		{[]string{"a", "b"}, "--tag: expected at least 2 arguments, got 0"},
+		{[]string{"a", "b", "--tag=x"}, "--tag: expected at least 2 arguments, got 1"},
+		{[]string{"a", "b", "--tag=1", "--tag=2", "--tag=3", "--tag=4"}, "--tag: expected at most 3 arguments, got 4"},
+		{[]string{"a", "--tag=1", "--tag=2"}, "FILE: expected 2 arguments, got 1"},
+	}
+	for _, test := range tests {
+		_, err := newCommand().Parse(test.args)
+		var argErr *ArgumentError
+		if assertErrorAs(t, err, &argErr) {
+			assertString(t, test.expect, argErr.String())
+		}
+	}
+}
+
+func TestParseReader(t *testing.T) {
+	var name, note string
+	var labels []string
+	var verbose bool
+	cmd := NewCommand("test", "").
+		WithTerminator().
+		Flags(
+			String(&name, "name", "", ""),
+			String(&note, "note", "", ""),
+			Strings(&labels, "label", nil, ""),
+			Bool(&verbose, "verbose", false, ""),
+		).
+		Must()
+	input := `# build options
+--name "my widget" # trailing comment
+--label 'team=platform' --label=a\ b
+--note "say \"hi\" #not a comment"
+--verbose \
+  -- 'x y' ""
+`
+	if _, err := cmd.ParseReader(strings.NewReader(input)); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "my widget", name)
+	assertStrings(t, []string{"team=platform", "a b"}, labels)
+	assertString(t, `say "hi" #not a comment`, note)
+	assertBool(t, true, verbose)
+	assertStrings(t, []string{"x y", ""}, cmd.Args())
+
+	if _, err := cmd.ParseReader(strings.NewReader(`--name "foo`)); err == nil {
+		t.Errorf("expected error for unterminated quote")
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		s      string
+		expect []string
+	}{
+		{"", []string{}},
+		{"  \t\n ", []string{}},
+		{"a b  c", []string{"a", "b", "c"}},
+		{"a\tb\nc\r\nd", []string{"a", "b", "c", "d"}},
+		{`'a b' "c d"`, []string{"a b", "c d"}},
+		{`'' ""`, []string{"", ""}},
+		{`a'b c'd`, []string{"ab cd"}},
+		{`"a"'b'c`, []string{"abc"}},
+		{`'a"b'`, []string{`a"b`}},
+		{`"a'b"`, []string{"a'b"}},
+		{`'a\b'`, []string{`a\b`}},
+		{`"a\"b"`, []string{`a"b`}},
+		{`"a\\b"`, []string{`a\b`}},
+		{`"a\$b\` + "`" + `"`, []string{"a$b`"}},
+		{`"a\nb"`, []string{`a\nb`}},
+		{`a\ b`, []string{"a b"}},
+		{`a\"b`, []string{`a"b`}},
+		{`it\'s`, []string{"it's"}},
+		{`\\`, []string{`\`}},
+		{"a\\\nb", []string{"ab"}},
+		{"\"a\\\nb\"", []string{"ab"}},
+		{"# comment\na", []string{"a"}},
+		{"a # comment\nb", []string{"a", "b"}},
+		{"a#b", []string{"a#b"}},
+		{`'#a' "#b" \#c`, []string{"#a", "#b", "#c"}},
+		{"$HOME *.go", []string{"$HOME", "*.go"}},
+	}
+	for _, test := range tests {
+		actual, err := SplitArgs(test.s)
+		if err != nil {
+			t.Errorf("%q: %v", test.s, err)
+			continue
+		}
+		assertStrings(t, test.expect, actual)
+	}
+
+	for _, s := range []string{`'a`, `"a`, `"a\"`, `a'b`, `a\`, `"a" 'b`} {
+		if _, err := SplitArgs(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func ExampleSplitArgs() {
+	args, err := SplitArgs(`--name "my widget" --label 'a=b' --note it\'s`)
+	if err != nil {
+		panic(err)
+	}
+	for _, arg := range args {
+		fmt.Println(arg)
+	}
+	// Output:
+	// --name
+	// my widget
+	// --label
+	// a=b
+	// --note
+	// it's
+}
+
+func TestDashedValues(t *testing.T) {
+	var prefix, password string
+	var verbose bool
+	newCommand := func() *Command {
+		prefix, password, verbose = "", "", false
+		return NewCommand("test", "").
+			WithTerminator().
+			Flags(
+				String(&prefix, "prefix", "", "").ShortName("p"),
+				String(&password, "password", "", "").Sensitive(),
+				Bool(&verbose, "verbose", false, ""),
+			).
+			Must()
+	}
+	for _, args := range [][]string{
+		{"--prefix=-foo"},
+		{"-p=-foo"},
+		{"-p-foo"},
+		{"--prefix=-foo", "--verbose"},
+	} {
+		if _, err := newCommand().Parse(args); err != nil {
+			t.Errorf("%q: %v", args, err)
+			continue
+		}
+		assertString(t, "-foo", prefix)
+	}
+	if _, err := newCommand().Parse([]string{"--prefix=--"}); err != nil {
+		t.Error(err)
+	}
+	assertString(t, "--", prefix)
+
+	tests := []struct {
+		args   []string
+		expect string
+	}{
+		{
+			[]string{"--prefix", "-foo"},
+			`--prefix: no value specified for flag: --prefix (use --prefix=-foo to specify a value that starts with "-")`,
+		},
+		{
+			[]string{"-p", "--foo"},
+			`--prefix: no value specified for flag: -p (use -p=--foo to specify a value that starts with "-")`,
+		},
+		{
+			[]string{"--password", "-secret"},
+			`--password: no value specified for flag: --password (use --password=VALUE to specify a value that starts with "-")`,
+		},
+		{
+			[]string{"--prefix", "--verbose"},
+			"--prefix: no value specified for flag: --prefix",
+		},
+	}
+	for _, test := range tests {
+		_, err := newCommand().Parse(test.args)
+		var argErr *ArgumentError
+		if assertErrorAs(t, err, &argErr) {
+			assertString(t, test.expect, argErr.String())
+		}
+	}
+}
+
+func TestNormalizer(t *testing.T) {
+	var name, subName string
+	var verbose bool
+	cmd := NewCommand("test", "").
+		WithTerminator().
+		Normalizer(func(args []string) []string {
+			a := make([]string, 0, len(args))
+			for i, arg := range args {
+				if arg == "--" {
+					return append(a, args[i:]...)
+				}
+				switch {
+				case arg == "-old":
+					arg = "--new"
+				case strings.HasPrefix(arg, "-old="):
+					arg = "--new=" + arg[5:]
+				case arg == "-vv":
+					a = append(a, "--verbose")
+					continue
+				}
+				a = append(a, arg)
 			}
+			return a
+		}).
+		Flags(
+			String(&name, "new", "", ""),
+			Bool(&verbose, "verbose", false, ""),
+		).
+		Subcommands(
+			NewCommand("sub", "").Flags(String(&subName, "new", "", "")),
+		).
+		Must()
+
+	for _, args := range [][]string{
+		{"-old", "foo", "-vv"},
+		{"-old=foo", "-vv"},
+		{"--new", "foo", "--verbose"},
+	} {
+		name, verbose = "", false
+		if _, err := cmd.Parse(args); err != nil {
+			t.Errorf("%q: %v", args, err)
+			continue
 		}
-	})
-	t.Run("WithTerminator", func(t *testing.T) {
-		tArgs := make([]string, len(args)*2)
-		copy(tArgs, args)
-		copy(tArgs[len(args):], args)
-		tExpect := make([]string, len(expect)+len(args))
-		copy(tExpect, expect)
-		copy(tExpect[len(expect):], args)
-		tActual := normalize(tArgs, true)
-		assertStrings(t, tExpect, tActual)
-	})
+		assertString(t, "foo", name)
+		assertBool(t, true, verbose)
+	}
+
+	// arguments after the terminator are left unchanged by this normalizer
+	if _, err := cmd.Parse([]string{"-old", "foo", "--", "-old"}); err != nil {
+		t.Fatal(err)
+	}
+	assertStrings(t, []string{"-old"}, cmd.Args())
+
+	// subcommands inherit the normalizer
+	target, err := cmd.Subcommands[0].Parse([]string{"-old", "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "sub", target.Name)
+	assertString(t, "bar", subName)
+}
+
+func TestNegativeNumbers(t *testing.T) {
+	var n, offset int
+	var x float64
+	newCommand := func() *Command {
+		n, offset, x = 0, 0, 0
+		return NewCommand("test", "").
+			Flags(
+				Int(&n, "n", 0, ""),
+				Int(&offset, "offset", 0, ""),
+				Float64(&x, "x", 0, "").Positional(),
+			).
+			Must()
+	}
+	tests := []struct {
+		args   []string
+		n      int
+		offset int
+		x      float64
+	}{
+		{[]string{"--offset", "-10"}, 0, -10, 0},
+		{[]string{"-n", "-10"}, -10, 0, 0},
+		{[]string{"-n=-10", "--offset=-5"}, -10, -5, 0},
+		{[]string{"-10"}, 0, 0, -10},
+		{[]string{"-2.5", "-n", "3"}, 3, 0, -2.5},
+		{[]string{"-.5"}, 0, 0, -0.5},
+	}
+	for _, test := range tests {
+		if _, err := newCommand().Parse(test.args); err != nil {
+			t.Errorf("%v: %v", test.args, err)
+			continue
+		}
+		assertInt64(t, int64(test.n), int64(n))
+		assertInt64(t, int64(test.offset), int64(offset))
+		assertFloat64(t, test.x, x)
+	}
+
+	// flags named like numbers take precedence
+	var one bool
+	cmd := NewCommand("test", "").
+		Flags(
+			Bool(&one, "1", false, ""),
+			Float64(&x, "x", 0, "").Positional(),
+		).
+		Must()
+	if _, err := cmd.Parse([]string{"-1", "-5"}); err != nil {
+		t.Fatal(err)
+	}
+	assertBool(t, true, one)
+	assertFloat64(t, -5, x)
+
+	// words accepted by strconv.ParseFloat are not negative numbers
+	for _, arg := range []string{"-inf", "-Inf", "-infinity", "-nan"} {
+		_, err := newCommand().Parse([]string{arg})
+		if err == nil {
+			t.Errorf("%s: expected error, got: %v", arg, x)
+		}
+	}
 }
 
 func TestTerminator(t *testing.T) {
@@ -66,3 +535,962 @@ func TestTerminator(t *testing.T) {
 	assertBool(t, true, bar)
 	assertStrings(t, tailArgs, cmd.Args())
 }
+
+func TestTerminatorInSubcommands(t *testing.T) {
+	var verbose, force bool
+	newCommand := func() *Command {
+		return NewCommand("app", "").
+			WithTerminator().
+			Flags(Bool(&verbose, "verbose", false, "")).
+			Subcommands(
+				NewCommand("run", "").
+					Flags(Bool(&force, "force", false, "")),
+				NewCommand("exec", "").
+					Terminator("++"),
+			).
+			Must()
+	}
+
+	// arguments after the terminator are given to the selected subcommand
+	cmd := newCommand()
+	target, err := cmd.Parse([]string{"run", "--verbose", "--", "x", "--force"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "run", target.Name)
+	assertBool(t, true, verbose)
+	assertBool(t, false, force)
+	assertStrings(t, []string{"x", "--force"}, target.Args())
+	assertStrings(t, nil, cmd.Args())
+
+	// arguments after the terminator are given to the parent if it is reached
+	// before a subcommand is selected
+	cmd = newCommand()
+	target, err = cmd.Parse([]string{"--", "run", "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "app", target.Name)
+	assertStrings(t, []string{"run", "x"}, target.Args())
+
+	// subcommands may override the terminator token
+	cmd = newCommand()
+	target, err = cmd.Parse([]string{"exec", "++", "--", "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "exec", target.Name)
+	assertStrings(t, []string{"--", "x"}, target.Args())
+}
+
+func TestCustomTerminator(t *testing.T) {
+	var verbose bool
+	cmd := NewCommand("test", "").
+		Terminator("++").
+		Flags(Bool(&verbose, "verbose", false, "")).
+		Must()
+	tailArgs := []string{"--verbose", "--", "-x", "++", ""}
+	args := append([]string{"--verbose", "++"}, tailArgs...)
+	if _, err := cmd.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	assertBool(t, true, verbose)
+	assertStrings(t, tailArgs, cmd.Args())
+
+	// "--" is not a terminator
+	_, err := cmd.Parse([]string{"--", "x"})
+	assertErrorAs(t, err, new(*ArgumentError))
+
+	for _, token := range []string{"-", "-x", "---"} {
+		_, err := NewCommand("test", "").Terminator(token).Command()
+		if err == nil {
+			t.Errorf("expected error for terminator %q", token)
+		}
+	}
+}
+
+func TestAllowExtraArgs(t *testing.T) {
+	var verbose bool
+	var name string
+	cmd := NewCommand("test", "").
+		AllowExtraArgs().
+		WithTerminator().
+		Flags(
+			Bool(&verbose, "verbose", false, ""),
+			String(&name, "name", "", "").Positional(),
+		).
+		Must()
+	args := []string{"foo", "bar", "--verbose", "baz", "--", "qux", "--verbose"}
+	if _, err := cmd.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	assertBool(t, true, verbose)
+	assertString(t, "foo", name)
+	assertStrings(t, []string{"bar", "baz"}, cmd.ExtraArgs())
+	assertStrings(t, []string{"qux", "--verbose"}, cmd.Args())
+
+	_, err := NewCommand("test", "").Must().Parse([]string{"foo"})
+	assertErrorAs(t, err, new(*ArgumentError))
+}
+
+func TestStopAtFirstPositional(t *testing.T) {
+	var verbose bool
+	var name string
+	cmd := NewCommand("exec", "").
+		StopAtFirstPositional().
+		Flags(
+			Bool(&verbose, "verbose", false, "").ShortName("v"),
+			String(&name, "name", "", "").Positional(),
+		).
+		Must()
+	_, err := cmd.Parse([]string{"-v", "test", "ls", "-v", "--", "--help"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBool(t, true, verbose)
+	assertString(t, "test", name)
+	assertStrings(t, []string{"ls", "-v", "--", "--help"}, cmd.Args())
+}
+
+func TestParseWithEnv(t *testing.T) {
+	var foo, bar string
+	cmd := NewCommand("test", "").
+		Flags(
+			String(&foo, "foo", "", "").Env("TEST_FOO"),
+			String(&bar, "bar", "", "").Env("TEST_BAR"),
+		).
+		Must()
+	env := map[string]string{
+		"TEST_FOO": "foo",
+		"TEST_BAR": "bar",
+	}
+	if _, err := cmd.ParseWithEnv([]string{"--bar=baz"}, env); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "foo", foo)
+	assertString(t, "baz", bar)
+}
+
+func TestConfigFile(t *testing.T) {
+	var config, foo, bar, baz, qux string
+	var count int
+	var verbose bool
+	var tags []string
+	cmd := NewCommand("test", "").
+		ConfigFile("config").
+		Flags(
+			String(&config, "config", "testdata/config.json", ""),
+			String(&foo, "foo", "", ""),
+			String(&bar, "bar", "", "").Env("TEST_BAR"),
+			String(&baz, "baz", "", "").Env("TEST_BAZ"),
+			String(&qux, "qux", "default", "").Env("TEST_QUX"),
+			Int(&count, "count", 0, ""),
+			Bool(&verbose, "verbose", false, ""),
+			Strings(&tags, "tags", nil, ""),
+		).
+		Must()
+	env := map[string]string{
+		"TEST_BAR": "env",
+		"TEST_QUX": "env",
+	}
+	if _, err := cmd.ParseWithEnv([]string{"--foo=cli"}, env); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "cli", foo)
+	assertString(t, "config", bar)
+	assertString(t, "config", baz)
+	assertString(t, "env", qux)
+	assertInt64(t, 3, int64(count))
+	assertBool(t, true, verbose)
+	assertStrings(t, []string{"a", "b"}, tags)
+}
+
+func TestEnvLists(t *testing.T) {
+	var name string
+	var tags, paths []string
+	var ports []int
+	cmd := NewCommand("test", "").
+		Flags(
+			String(&name, "name", "", "").Env("TEST_NAME"),
+			Strings(&tags, "tag", nil, "").Env("TEST_TAGS"),
+			Strings(&paths, "path", nil, "").Env("TEST_PATH").EnvSeparator(":"),
+			Ints(&ports, "port", nil, "").Env("TEST_PORTS"),
+		).
+		Must()
+	_, err := cmd.ParseWithEnv(nil, map[string]string{
+		"TEST_NAME":  "a,b",
+		"TEST_TAGS":  "a,b,c",
+		"TEST_PATH":  "/bin:/usr/bin",
+		"TEST_PORTS": "80",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "a,b", name)
+	assertStrings(t, []string{"a", "b", "c"}, tags)
+	assertStrings(t, []string{"/bin", "/usr/bin"}, paths)
+	if len(ports) != 1 || ports[0] != 80 {
+		t.Errorf("expected [80], got %v", ports)
+	}
+}
+
+func TestEnvVarsInSubcommands(t *testing.T) {
+	var region, name string
+	var replicas int
+	newCommand := func() *Command {
+		region, name, replicas = "", "", 0
+		return NewCommand("app", "").
+			Flags(String(&region, "region", "", "").Env("TEST_REGION")).
+			Subcommands(
+				NewCommand("deploy", "").
+					Flags(
+						String(&name, "name", "", "").Env("TEST_NAME"),
+						Int(&replicas, "replicas", 1, "").Env("TEST_REPLICAS"),
+					),
+			).
+			Must()
+	}
+	env := map[string]string{
+		"TEST_REGION":   "us-east-1",
+		"TEST_NAME":     "web",
+		"TEST_REPLICAS": "3",
+	}
+
+	// flags of the invoked subcommand and its parent are set
+	if _, err := newCommand().ParseWithEnv([]string{"deploy"}, env); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "us-east-1", region)
+	assertString(t, "web", name)
+	assertInt64(t, 3, int64(replicas))
+
+	// the command line takes precedence, before or after the subcommand
+	args := []string{"deploy", "--region", "eu-west-1", "--replicas", "5"}
+	if _, err := newCommand().ParseWithEnv(args, env); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "eu-west-1", region)
+	assertString(t, "web", name)
+	assertInt64(t, 5, int64(replicas))
+
+	// flags of subcommands that are not invoked are not set
+	if _, err := newCommand().ParseWithEnv(nil, env); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "us-east-1", region)
+	assertString(t, "", name)
+	assertInt64(t, 1, int64(replicas))
+}
+
+func TestMarshalValues(t *testing.T) {
+	var name, token, debug, config string
+	var n int
+	var verbose bool
+	var tags []string
+	var timeout time.Duration
+	cmd := NewCommand("app", "").
+		ConfigFile("config").
+		Flags(
+			String(&config, "config", "", ""),
+			Bool(&verbose, "verbose", false, ""),
+			String(&debug, "debug", "", "").Hidden(),
+		).
+		Subcommands(
+			NewCommand("deploy", "").
+				Flags(
+					String(&name, "name", "", ""),
+					Int(&n, "replicas", 1, ""),
+					Strings(&tags, "tag", nil, ""),
+					Duration(&timeout, "timeout", 0, ""),
+					String(&token, "token", "", "").Sensitive(),
+				),
+		).
+		Must()
+	deploy, err := cmd.Parse([]string{
+		"--debug=trace",
+		"deploy",
+		"--name=web",
+		"--replicas=3",
+		"--tag=a",
+		"--tag=b",
+		"--timeout=1m30s",
+		"--token=secret",
+		"--verbose",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := deploy.MarshalValues()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, `{
+  "name": "web",
+  "replicas": 3,
+  "tag": [
+    "a",
+    "b"
+  ],
+  "timeout": "1m30s",
+  "verbose": true
+}`, string(b))
+
+	b, err = deploy.MarshalAllValues()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"debug": "trace"`) {
+		t.Errorf("expected hidden flag in output, got:\n%s", b)
+	}
+}
+
+func TestMarshalValuesRoundTrip(t *testing.T) {
+	type values struct {
+		config  string
+		name    string
+		token   string
+		verbose int
+		n       int
+		tags    []string
+		timeout time.Duration
+	}
+	newCommand := func(v *values) *Command {
+		return NewCommand("app", "").
+			ConfigFile("config").
+			Flags(
+				String(&v.config, "config", "", ""),
+				String(&v.name, "name", "", ""),
+				String(&v.token, "token", "", "").Sensitive(),
+				Count(&v.verbose, "verbose", ""),
+				Int(&v.n, "replicas", 1, ""),
+				Strings(&v.tags, "tag", nil, ""),
+				Duration(&v.timeout, "timeout", 0, ""),
+			).
+			Must()
+	}
+	var src values
+	cmd := newCommand(&src)
+	_, err := cmd.Parse([]string{
+		"--name=web",
+		"--token=secret",
+		"--verbose",
+		"--verbose",
+		"--verbose",
+		"--replicas=3",
+		"--tag=a",
+		"--tag=b",
+		"--timeout=1m30s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := cmd.MarshalValues()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "token") {
+		t.Errorf("expected sensitive flag to be omitted, got:\n%s", b)
+	}
+	path := t.TempDir() + "/config.json"
+	if err := ioutil.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var dst values
+	if _, err := newCommand(&dst).Parse([]string{"--config", path}); err != nil {
+		t.Fatalf("error reading back marshaled values: %v\n%s", err, b)
+	}
+	assertString(t, "web", dst.name)
+	assertString(t, "", dst.token)
+	assertInt64(t, 3, int64(dst.verbose))
+	assertInt64(t, 3, int64(dst.n))
+	assertStrings(t, []string{"a", "b"}, dst.tags)
+	assertDuration(t, 90*time.Second, dst.timeout)
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	var config, foo string
+	newCommand := func() *Command {
+		return NewCommand("test", "").
+			ConfigFile("config").
+			Flags(
+				String(&config, "config", "", ""),
+				String(&foo, "foo", "", ""),
+			).
+			Must()
+	}
+	if _, err := newCommand().Parse(nil); err != nil {
+		t.Errorf("expected no error without a config file, got: %v", err)
+	}
+	_, err := newCommand().Parse([]string{"--config", "testdata/missing.json"})
+	assertErrorAs(t, err, new(*ArgumentError))
+	_, err = newCommand().Parse([]string{"--config", "testdata/config.json"})
+	assertErrorAs(t, err, new(*ArgumentError))
+
+	// the config file flag is checked when the command is built
+	_, err = NewCommand("test", "").
+		ConfigFile("nope").
+		Flags(String(&config, "config", "", "")).
+		Command()
+	if err == nil || err.Error() != "xflags: test: config file flag not declared: --nope" {
+		t.Errorf("expected error for undeclared config file flag, got: %v", err)
+	}
+	_, err = NewCommand("test", "").
+		ConfigFile("config").
+		Flags(Func("config", "", func(string) error { return nil })).
+		Command()
+	if err == nil {
+		t.Errorf("expected error for config file flag without fmt.Stringer")
+	}
+}
+
+func TestResponseFiles(t *testing.T) {
+	var foo string
+	var tags []string
+	newCommand := func() *Command {
+		foo, tags = "", nil
+		return NewCommand("test", "").
+			WithResponseFiles().
+			WithTerminator().
+			Flags(
+				String(&foo, "foo", "", ""),
+				Strings(&tags, "tags", nil, ""),
+			).
+			Must()
+	}
+
+	cmd, err := newCommand().Parse([]string{"@testdata/outer.args", "--tags", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "bar", foo)
+	assertStrings(t, []string{"a", "b", "c"}, tags)
+	assertStrings(t, nil, cmd.Args())
+
+	cmd, err = newCommand().Parse([]string{"--foo", "@@bar", "--", "@baz"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "@bar", foo)
+	assertStrings(t, []string{"@baz"}, cmd.Args())
+
+	if _, err = newCommand().Parse([]string{"@testdata/quoted.args"}); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "bar baz", foo)
+	assertStrings(t, []string{"a b", "c d"}, tags)
+
+	_, err = newCommand().Parse([]string{"@testdata/missing.args"})
+	assertErrorAs(t, err, new(*ArgumentError))
+	_, err = newCommand().Parse([]string{"@testdata/loop.args"})
+	assertErrorAs(t, err, new(*ArgumentError))
+}
+
+func TestCombinedShortFlags(t *testing.T) {
+	var a, b, c bool
+	var s string
+	newCommand := func() *Command {
+		a, b, c, s = false, false, false, ""
+		return NewCommand("test", "").
+			Flags(
+				Bool(&a, "a", false, ""),
+				Bool(&b, "b", false, ""),
+				Bool(&c, "c", false, ""),
+				String(&s, "s", "", ""),
+			).
+			Must()
+	}
+
+	if _, err := newCommand().Parse([]string{"-abc"}); err != nil {
+		t.Error(err)
+	} else {
+		assertBool(t, true, a)
+		assertBool(t, true, b)
+		assertBool(t, true, c)
+	}
+
+	if _, err := newCommand().Parse([]string{"-acsfoo"}); err != nil {
+		t.Error(err)
+	} else {
+		assertBool(t, true, a)
+		assertBool(t, false, b)
+		assertBool(t, true, c)
+		assertString(t, "foo", s)
+	}
+
+	if _, err := newCommand().Parse([]string{"-ab=false"}); err != nil {
+		t.Error(err)
+	} else {
+		assertBool(t, true, a)
+		assertBool(t, false, b)
+	}
+
+	errorCases := [][]string{
+		{"-ab=val"},
+		{"-abx"},
+		{"-a-b"},
+		{"-aa"},
+	}
+	for _, args := range errorCases {
+		_, err := newCommand().Parse(args)
+		assertErrorAs(t, err, new(*ArgumentError))
+	}
+}
+
+func TestSuggestions(t *testing.T) {
+	var verbose bool
+	var n int
+	cmd := NewCommand("widgets", "").
+		Flags(
+			Bool(&verbose, "verbose", false, ""),
+			Int(&n, "n", 1, ""),
+			Bool(&verbose, "secret", false, "").Hidden(),
+		).
+		Subcommands(
+			NewCommand("create", ""),
+			NewCommand("destroy", ""),
+		).
+		Must()
+	testCases := []struct {
+		args   []string
+		expect string
+	}{
+		{[]string{"creat"}, `unrecognized command: creat, did you mean "create"?`},
+		{[]string{"destory"}, `unrecognized command: destory, did you mean "destroy"?`},
+		{[]string{"list"}, "unrecognized command: list"},
+		{[]string{"--verbos"}, `unrecognized argument: --verbos, did you mean "--verbose"?`},
+		{[]string{"--vrebose"}, `unrecognized argument: --vrebose, did you mean "--verbose"?`},
+		{[]string{"--quiet"}, "unrecognized argument: --quiet"},
+		{[]string{"--secre"}, "unrecognized argument: --secre"},
+	}
+	for _, testCase := range testCases {
+		_, err := cmd.Parse(testCase.args)
+		var argErr *ArgumentError
+		if assertErrorAs(t, err, &argErr) {
+			assertString(t, testCase.expect, argErr.String())
+		}
+	}
+}
+
+func TestUnknownFlagError(t *testing.T) {
+	var verbose bool
+	cmd := NewCommand("test", "").
+		Flags(Bool(&verbose, "verbose", false, "")).
+		Must()
+	_, err := cmd.Parse([]string{"--verbos=true"})
+	var unknownErr *UnknownFlagError
+	if assertErrorAs(t, err, &unknownErr) {
+		assertString(t, "--verbos", unknownErr.Arg)
+		assertString(t, "--verbose", unknownErr.Suggestion)
+		if unknownErr.Cmd != cmd {
+			t.Errorf("expected command %v, got %v", cmd, unknownErr.Cmd)
+		}
+	}
+	assertErrorAs(t, err, new(*ArgumentError))
+}
+
+func TestIgnoreUnknownFlags(t *testing.T) {
+	var verbose bool
+	var name string
+	cmd := NewCommand("test", "").
+		IgnoreUnknownFlags().
+		Flags(Bool(&verbose, "verbose", false, "")).
+		Subcommands(
+			NewCommand("sub", "").
+				Flags(String(&name, "name", "", "").Positional()),
+		).
+		Must()
+	sub, err := cmd.Parse([]string{"-x", "sub", "--verbose", "--foo=bar", "baz"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBool(t, true, verbose)
+	assertString(t, "baz", name)
+	assertStrings(t, []string{"-x", "--foo=bar"}, sub.UnknownArgs())
+}
+
+func TestInterspersedParentFlags(t *testing.T) {
+	var verbose, quiet, childQuiet, force bool
+	var name string
+	newCommand := func() *Command {
+		verbose, quiet, childQuiet, force, name = false, false, false, false, ""
+		return NewCommand("app", "").
+			Flags(
+				Bool(&verbose, "verbose", false, "").ShortName("v"),
+				Bool(&quiet, "quiet", false, "").Negatable(),
+			).
+			Subcommands(
+				NewCommand("create", "").
+					Flags(
+						Bool(&force, "force", false, ""),
+						Bool(&childQuiet, "quiet", false, ""),
+						String(&name, "name", "", "").Positional(),
+					),
+			).
+			Must()
+	}
+	tests := [][]string{
+		{"--verbose", "create", "--force", "widget"},
+		{"create", "--verbose", "--force", "widget"},
+		{"create", "--force", "widget", "-v"},
+	}
+	for _, args := range tests {
+		if _, err := newCommand().Parse(args); err != nil {
+			t.Errorf("%v: %v", args, err)
+			continue
+		}
+		assertBool(t, true, verbose)
+		assertBool(t, true, force)
+		assertString(t, "widget", name)
+	}
+
+	// flags shadowed by a subcommand are not resolved by the parent.
+	if _, err := newCommand().Parse([]string{"create", "--quiet"}); err != nil {
+		t.Fatal(err)
+	}
+	assertBool(t, false, quiet)
+	assertBool(t, true, childQuiet)
+	_, err := newCommand().Parse([]string{"create", "--no-quiet"})
+	assertErrorAs(t, err, new(*UnknownFlagError))
+}
+
+func TestDeprecated(t *testing.T) {
+	var old, verbose bool
+	w := &bytes.Buffer{}
+	cmd := NewCommand("test", "").
+		Output(w, w).
+		Flags(
+			Bool(&old, "old", false, "Old behavior").
+				ShortName("o").
+				Deprecated("use --new instead").
+				Env("TEST_OLD").
+				Overwrite(),
+			Bool(&verbose, "verbose", false, "").ShortName("v"),
+		).
+		Subcommands(
+			NewCommand("legacy", "Legacy command").Deprecated("use modern instead"),
+		).
+		Must()
+
+	if _, err := cmd.ParseWithEnv([]string{"--old", "-vo", "legacy"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	assertBool(t, true, old)
+	assertString(
+		t,
+		"Warning: --old is deprecated: use --new instead\n"+
+			"Warning: -o is deprecated: use --new instead\n"+
+			"Warning: command legacy is deprecated: use modern instead\n",
+		w.String(),
+	)
+
+	w.Reset()
+	env := map[string]string{"TEST_OLD": "true"}
+	if _, err := cmd.ParseWithEnv([]string{"legacy"}, env); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "Warning: command legacy is deprecated: use modern instead\n", w.String())
+
+	w.Reset()
+	if err := cmd.WriteUsage(w); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"Old behavior (deprecated: use --new instead)",
+		"Legacy command (deprecated: use modern instead)",
+	} {
+		if !strings.Contains(w.String(), s) {
+			t.Errorf("expected help message to contain %q, got:\n%s", s, w.String())
+		}
+	}
+}
+
+func TestRequiredTogether(t *testing.T) {
+	var cert, key, name string
+	cmd := NewCommand("test", "").
+		Flags(
+			String(&cert, "tls-cert", "", ""),
+			String(&key, "tls-key", "", "").Env("TEST_TLS_KEY"),
+			String(&name, "name", "", ""),
+		).
+		RequiredTogether("tls-cert", "tls-key").
+		Must()
+	testCases := []struct {
+		args []string
+		env  map[string]string
+		ok   bool
+	}{
+		{[]string{"--name", "foo"}, nil, true},
+		{[]string{"--tls-cert", "a.crt", "--tls-key", "a.key"}, nil, true},
+		{[]string{"--tls-cert", "a.crt"}, map[string]string{"TEST_TLS_KEY": "a.key"}, true},
+		{[]string{"--tls-cert", "a.crt"}, nil, false},
+		{nil, map[string]string{"TEST_TLS_KEY": "a.key"}, false},
+	}
+	for _, testCase := range testCases {
+		_, err := cmd.ParseWithEnv(testCase.args, testCase.env)
+		if testCase.ok {
+			if err != nil {
+				t.Errorf("%q: %v", testCase.args, err)
+			}
+			continue
+		}
+		assertErrorAs(t, err, new(*ArgumentError))
+	}
+
+	_, err := NewCommand("test", "").
+		Flags(String(&cert, "tls-cert", "", "")).
+		RequiredTogether("tls-cert", "tls-key").
+		Command()
+	if err == nil {
+		t.Errorf("expected error for undeclared flag")
+	}
+}
+
+func TestCaseInsensitiveFlags(t *testing.T) {
+	var verbose, upper, quiet bool
+	var name string
+	cmd := NewCommand("test", "").
+		CaseInsensitiveFlags().
+		Flags(
+			Bool(&verbose, "verbose", false, "").ShortName("v"),
+			Bool(&upper, "V", false, ""),
+			Bool(&quiet, "quiet", false, "").Negatable(),
+		).
+		Subcommands(
+			NewCommand("sub", "").Flags(String(&name, "Name", "", "")),
+		).
+		Must()
+	if _, err := cmd.Parse([]string{"--VERBOSE", "--No-Quiet", "sub", "--name", "foo"}); err != nil {
+		t.Fatal(err)
+	}
+	assertBool(t, true, verbose)
+	assertBool(t, false, upper)
+	assertString(t, "foo", name)
+	if _, err := cmd.Parse([]string{"-V"}); err != nil {
+		t.Fatal(err)
+	}
+	assertBool(t, true, upper)
+
+	_, err := NewCommand("test", "").
+		CaseInsensitiveFlags().
+		Flags(
+			Bool(&verbose, "Foo", false, ""),
+			Bool(&verbose, "foo", false, ""),
+		).
+		Command()
+	if err == nil {
+		t.Errorf("expected error for flags that differ only by case")
+	}
+	_, err = NewCommand("test", "").
+		Flags(
+			Bool(&verbose, "Foo", false, ""),
+			Bool(&verbose, "foo", false, ""),
+		).
+		Command()
+	if err != nil {
+		t.Errorf("expected case-sensitive flags not to collide, got: %v", err)
+	}
+}
+
+func TestAllowAbbreviations(t *testing.T) {
+	var verbose, version, quiet bool
+	var ver string
+	newCommand := func() *Command {
+		verbose, version, quiet, ver = false, false, false, ""
+		return NewCommand("test", "").
+			AllowAbbreviations().
+			Flags(
+				Bool(&verbose, "verbose", false, ""),
+				Bool(&version, "version", false, ""),
+				String(&ver, "ver", "", ""),
+				Bool(&quiet, "quiet", true, "").Negatable(),
+			).
+			Must()
+	}
+
+	if _, err := newCommand().Parse([]string{"--verb", "--q=false"}); err != nil {
+		t.Fatal(err)
+	}
+	assertBool(t, true, verbose)
+	assertBool(t, false, quiet)
+
+	if _, err := newCommand().Parse([]string{"--ver", "1", "--no-q"}); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "1", ver)
+	assertBool(t, false, verbose)
+	assertBool(t, false, quiet)
+
+	_, err := newCommand().Parse([]string{"--ve"})
+	var argErr *ArgumentError
+	if assertErrorAs(t, err, &argErr) {
+		assertString(
+			t,
+			"ambiguous argument: --ve, could be: --ver, --verbose, --version",
+			argErr.Text,
+		)
+	}
+
+	_, err = NewCommand("test", "").
+		Flags(Bool(&verbose, "verbose", false, "")).
+		Must().
+		Parse([]string{"--verb"})
+	assertErrorAs(t, err, new(*ArgumentError))
+}
+
+func TestEnvVarNames(t *testing.T) {
+	var s string
+	for _, name := range []string{"APP_TOKEN", "_TOKEN", "TOKEN2", "lower_case"} {
+		_, err := NewCommand("test", "").
+			Flags(String(&s, "token", "", "").Env(name)).
+			Command()
+		if err != nil {
+			t.Errorf("%q: %v", name, err)
+		}
+	}
+	for _, name := range []string{"my-var", "2TOKEN", "A=B", "APP TOKEN", "TOKÉN"} {
+		_, err := NewCommand("test", "").
+			Flags(String(&s, "token", "", "").Env(name)).
+			Command()
+		if err == nil {
+			t.Errorf("%q: expected error", name)
+		}
+	}
+	if _, err := NewCommand("test", "").EnvPrefix("my-app").Command(); err == nil {
+		t.Errorf("expected error for invalid prefix")
+	}
+}
+
+func TestEnvPrefix(t *testing.T) {
+	var logLevel, region, name, token string
+	cmd := NewCommand("app", "").
+		EnvPrefix("app").
+		Flags(
+			String(&logLevel, "log-level", "", "Log level"),
+			String(&token, "token", "", "API token").Env("API_TOKEN"),
+		).
+		Subcommands(
+			NewCommand("deploy", "").
+				EnvPrefix("DEPLOY").
+				Flags(String(&name, "name", "", "Name")),
+			NewCommand("status", "").
+				Flags(String(&region, "region", "", "Region")),
+		).
+		Must()
+	env := map[string]string{
+		"APP_LOG_LEVEL":     "debug",
+		"APP_TOKEN":         "ignored",
+		"API_TOKEN":         "secret",
+		"APP_DEPLOY_NAME":   "foo",
+		"APP_STATUS_NAME":   "ignored",
+		"APP_REGION":        "us-east-1",
+		"APP_DEPLOY_REGION": "ignored",
+	}
+	if _, err := cmd.ParseWithEnv([]string{"deploy"}, env); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "debug", logLevel)
+	assertString(t, "secret", token)
+	assertString(t, "foo", name)
+	if _, err := cmd.ParseWithEnv([]string{"status"}, env); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "us-east-1", region)
+
+	w := &bytes.Buffer{}
+	if err := cmd.Subcommands[0].WriteUsage(w); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"APP_LOG_LEVEL", "API_TOKEN", "APP_DEPLOY_NAME"} {
+		if !strings.Contains(w.String(), s) {
+			t.Errorf("expected help message to contain %q, got:\n%s", s, w.String())
+		}
+	}
+}
+
+func TestRequiredFromEnv(t *testing.T) {
+	var token, name string
+	cmd := NewCommand("test", "").
+		Flags(
+			String(&token, "token", "", "API token").Env("TEST_TOKEN").Required(),
+			String(&name, "name", "", "Name").Required(),
+		).
+		Must()
+
+	if _, err := cmd.ParseWithEnv([]string{"--name", "foo"}, map[string]string{"TEST_TOKEN": "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, "secret", token)
+
+	var argErr *ArgumentError
+	_, err := cmd.ParseWithEnv([]string{"--name", "foo"}, nil)
+	if assertErrorAs(t, err, &argErr) {
+		assertString(t, "missing argument (or environment variable TEST_TOKEN)", argErr.Text)
+		assertString(t, "--token: missing argument (or environment variable TEST_TOKEN)", argErr.String())
+	}
+	_, err = cmd.ParseWithEnv(nil, map[string]string{"TEST_TOKEN": "secret"})
+	if assertErrorAs(t, err, &argErr) {
+		assertString(t, "--name: missing argument", argErr.String())
+	}
+
+	w := &bytes.Buffer{}
+	if err := cmd.WriteUsage(w); err != nil {
+		t.Fatal(err)
+	}
+	assertString(
+		t,
+		"Usage: test --token TOKEN --name NAME\n\n"+
+			"Options:\n"+
+			"   --token  API token (required)\n"+
+			"   --name   Name (required)\n\n"+
+			"Environment variables:\n"+
+			"  TEST_TOKEN  --token  API token\n",
+		w.String(),
+	)
+}
+
+func FuzzParse(f *testing.F) {
+	for _, args := range [][]string{
+		{"-abc", "--name=foo", "create", "--", "x"},
+		{"--no-quiet", "-n", "-1", "--tags=a,b", "pos1", "pos2"},
+		{"--=value", "-", "--", "-=", "-a="},
+		{"--verb", "--help", "@args"},
+		{"create", "--force", "-vvv", "--size", "10"},
+	} {
+		f.Add(strings.Join(args, "\n"))
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		var a, b, c, force, quiet bool
+		var name, item string
+		var n, v, size int
+		var tags, rest []string
+		cmd := NewCommand("test", "").
+			Output(ioutil.Discard, ioutil.Discard).
+			AllowAbbreviations().
+			Flags(
+				Bool(&a, "a", false, ""),
+				Bool(&b, "b", false, ""),
+				Bool(&c, "c", false, ""),
+				Bool(&quiet, "quiet", false, "").Negatable(),
+				String(&name, "name", "", "").Deprecated("use something else"),
+				Int(&n, "n", 0, ""),
+				Count(&v, "v", ""),
+				Strings(&tags, "tags", nil, "").Separator(","),
+			).
+			Subcommands(
+				NewCommand("create", "").
+					WithTerminator().
+					Flags(
+						Bool(&force, "force", false, "").ShortName("f"),
+						Int(&size, "size", 0, ""),
+						String(&item, "item", "", "").Positional(),
+						Strings(&rest, "rest", nil, "").Positional().NArgs(0, 0),
+					),
+			).
+			Must()
+		args := strings.Split(s, "\n")
+		target, err := cmd.Parse(args)
+		if (target == nil) == (err == nil) {
+			t.Fatalf("%q: expected either a command or an error, got %v, %v", args, target, err)
+		}
+	})
+}
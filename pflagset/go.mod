@@ -0,0 +1,8 @@
+module github.com/cavaliergopher/xflags/pflagset
+
+go 1.18
+
+require (
+	github.com/cavaliergopher/xflags v0.2.0
+	github.com/spf13/pflag v1.0.10
+)
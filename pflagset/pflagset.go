@@ -0,0 +1,65 @@
+// Package pflagset imports flags defined with github.com/spf13/pflag into
+// xflags commands.
+//
+// It is a separate module with its own go.mod so that programs which do not
+// use pflag do not depend on it.
+//
+//     var fs = pflag.NewFlagSet("app", pflag.ContinueOnError)
+//
+//     var App = xflags.NewCommand("app", "").Flags(pflagset.Flags(fs)...)
+package pflagset
+
+import (
+	"github.com/cavaliergopher/xflags"
+	"github.com/spf13/pflag"
+)
+
+// Flags returns a Flagger for each flag in the given FlagSet, in
+// lexicographical order. The long name, shorthand, usage, hidden and
+// deprecated status of each flag are preserved. All parsing and error handling
+// is managed by xflags.
+//
+// Slice flags such as those created with pflag.StringSlice may be repeated.
+// Defaults are shown in help messages unless they are the zero value of the
+// flag.
+//
+// Flags with an optional value, other than booleans, always require a value as
+// xflags cannot parse them without one. Flags with a single character name are
+// imported as short flags.
+func Flags(fs *pflag.FlagSet) []xflags.Flagger {
+	a := make([]xflags.Flagger, 0)
+	fs.VisitAll(func(f *pflag.Flag) {
+		a = append(a, newFlag(f))
+	})
+	return a
+}
+
+func newFlag(f *pflag.Flag) *xflags.FlagBuilder {
+	b := xflags.Var(f.Value, f.Name, f.Usage)
+	if f.Shorthand != "" {
+		b = b.ShortName(f.Shorthand)
+	}
+	if _, ok := f.Value.(pflag.SliceValue); ok {
+		b = b.NArgs(0, 0)
+	}
+	if f.Hidden {
+		b = b.Hidden()
+	}
+	if f.Deprecated != "" {
+		b = b.Deprecated(f.Deprecated)
+	}
+	if !isZeroValue(f) {
+		b = b.ShowDefault()
+	}
+	return b
+}
+
+// isZeroValue returns true if the default value of a flag is the zero value
+// of its type.
+func isZeroValue(f *pflag.Flag) bool {
+	switch f.DefValue {
+	case "", "false", "0", "0s", "[]", "<nil>":
+		return true
+	}
+	return false
+}
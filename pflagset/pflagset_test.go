@@ -0,0 +1,53 @@
+package pflagset
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cavaliergopher/xflags"
+	"github.com/spf13/pflag"
+)
+
+func TestFlags(t *testing.T) {
+	fs := pflag.NewFlagSet("app", pflag.ContinueOnError)
+	verbose := fs.BoolP("verbose", "v", false, "Print verbose output")
+	name := fs.StringP("name", "n", "world", "Name to greet")
+	tags := fs.StringSlice("tag", nil, "Tags to apply")
+	secret := fs.String("secret", "", "Hidden flag")
+	if err := fs.MarkHidden("secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := xflags.NewCommand("app", "").Flags(Flags(fs)...).Must()
+	args := []string{"-v", "-n", "gopher", "--tag=a", "--tag=b,c", "--secret=x"}
+	if _, err := cmd.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	if !*verbose {
+		t.Errorf("expected verbose to be true")
+	}
+	if *name != "gopher" {
+		t.Errorf("expected name %q, got %q", "gopher", *name)
+	}
+	if len(*tags) != 3 {
+		t.Errorf("expected 3 tags, got %v", *tags)
+	}
+	if *secret != "x" {
+		t.Errorf("expected secret %q, got %q", "x", *secret)
+	}
+
+	w := &bytes.Buffer{}
+	if err := xflags.Format(w, xflags.NewCommand("app", "").Flags(Flags(fs)...).Must()); err != nil {
+		t.Fatal(err)
+	}
+	expect := `Usage: app [OPTIONS]
+
+Options:
+  -n, --name     Name to greet (default: gopher)
+      --tag      Tags to apply
+  -v, --verbose  Print verbose output
+`
+	if w.String() != expect {
+		t.Errorf("expected:\n%s\ngot:\n%s", expect, w.String())
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package xflags
+
+// terminalWidth returns the number of columns of the terminal referred to by
+// the file descriptor fd. Terminals are not detected on this platform so ok is
+// always false.
+func terminalWidth(fd uintptr) (width int, ok bool) {
+	return 0, false
+}
@@ -0,0 +1,27 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package xflags
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// terminalWidth returns the number of columns of the terminal referred to by
+// the file descriptor fd. If fd is not a terminal, ok is false.
+func terminalWidth(fd uintptr) (width int, ok bool) {
+	var ws struct {
+		Row, Col, Xpixel, Ypixel uint16
+	}
+	_, _, errno := syscall.Syscall(
+		syscall.SYS_IOCTL,
+		fd,
+		uintptr(syscall.TIOCGWINSZ),
+		uintptr(unsafe.Pointer(&ws)),
+	)
+	if errno != 0 {
+		return 0, false
+	}
+	return int(ws.Col), true
+}
@@ -0,0 +1,28 @@
+# bash completion for widgets
+
+_widgets() {
+    local cur prev cmdpath word i
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+    cmdpath='widgets'
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        word="${COMP_WORDS[i]}"
+        case "${cmdpath} ${word}" in
+            'widgets create'|'widgets destroy') cmdpath="${cmdpath} ${word}" ;;
+        esac
+    done
+    case "${cmdpath} ${prev}" in
+        'widgets --color') COMPREPLY=($(compgen -W 'auto always never' -- "${cur}")); return ;;
+        'widgets create --format') COMPREPLY=($(compgen -W 'json text' -- "${cur}")); return ;;
+        'widgets create --name') COMPREPLY=($("${COMP_WORDS[0]}" __complete -- "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null)); return ;;
+        'widgets create --color') COMPREPLY=($(compgen -W 'auto always never' -- "${cur}")); return ;;
+        'widgets destroy --color') COMPREPLY=($(compgen -W 'auto always never' -- "${cur}")); return ;;
+    esac
+    case "${cmdpath}" in
+        'widgets') COMPREPLY=($(compgen -W 'create destroy --verbose -v --color' -- "${cur}")) ;;
+        'widgets create') COMPREPLY=($(compgen -W '-n --format --name --verbose -v --color' -- "${cur}")) ;;
+        'widgets destroy') COMPREPLY=($(compgen -W '--verbose -v --color' -- "${cur}")) ;;
+    esac
+}
+
+complete -F _widgets widgets
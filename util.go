@@ -2,6 +2,7 @@ package xflags
 
 import (
 	"io"
+	"sort"
 )
 
 type aggregatedWriter struct {
@@ -30,3 +31,54 @@ func (w *aggregatedWriter) Write(p []byte) (n int, err error) {
 func (w *aggregatedWriter) N() int64                     { return w.n }
 func (w *aggregatedWriter) Err() error                   { return w.err }
 func (w *aggregatedWriter) Result() (n int64, err error) { return w.n, w.err }
+
+// levenshtein returns the edit distance between two strings.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// suggest returns the candidate that is most similar to s or an empty string
+// if no candidate is similar enough to be a likely typo of s.
+func suggest(s string, candidates []string) string {
+	sort.Strings(candidates)
+	maxDistance := len(s) / 3
+	if maxDistance > 2 {
+		maxDistance = 2
+	}
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+	best, bestDistance := "", maxDistance+1
+	for _, candidate := range candidates {
+		if d := levenshtein(s, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
@@ -1,8 +1,16 @@
 package xflags
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -22,6 +30,12 @@ type BoolValue interface {
 	IsBoolFlag() bool
 }
 
+// getter is implemented by values that can return the typed value they hold,
+// like flag.Getter.
+type getter interface {
+	Get() interface{}
+}
+
 func isBoolValue(v Value) bool {
 	if bv, ok := v.(BoolValue); ok {
 		return bv.IsBoolFlag()
@@ -32,6 +46,46 @@ func isBoolValue(v Value) bool {
 // ValidateFunc is a function that validates an argument before it is parsed.
 type ValidateFunc = func(arg string) error
 
+// ValidateValueFunc is a function that validates the value of a flag after an
+// argument is parsed.
+type ValidateValueFunc = func(v Value) error
+
+type accumulateValue[T any] struct {
+	p       *T
+	parse   func(s string) (T, error)
+	combine func(acc, v T) T
+	format  func(v T) string
+}
+
+func newAccumulateValue[T any](
+	p *T,
+	parse func(s string) (T, error),
+	combine func(acc, v T) T,
+) *accumulateValue[T] {
+	return &accumulateValue[T]{p: p, parse: parse, combine: combine}
+}
+
+func (p *accumulateValue[T]) String() string {
+	if p.p == nil {
+		return ""
+	}
+	if p.format != nil {
+		return p.format(*p.p)
+	}
+	return fmt.Sprint(*p.p)
+}
+
+func (p *accumulateValue[T]) Get() interface{} { return *p.p }
+
+func (p *accumulateValue[T]) Set(s string) error {
+	v, err := p.parse(s)
+	if err != nil {
+		return err
+	}
+	*p.p = p.combine(*p.p, v)
+	return nil
+}
+
 type bitFieldValue struct {
 	p    *uint64
 	mask uint64
@@ -45,7 +99,12 @@ func newBitFieldValue(val bool, p *uint64, mask uint64) *bitFieldValue {
 
 func (p *bitFieldValue) IsBoolFlag() bool { return true }
 
-func (p *bitFieldValue) String() string { return fmt.Sprintf("0x%0x", *p.p) }
+func (p *bitFieldValue) String() string {
+	if p.p == nil {
+		return ""
+	}
+	return fmt.Sprintf("0x%0x", *p.p)
+}
 
 func (p *bitFieldValue) Get() interface{} { return *p.p }
 
@@ -86,6 +145,94 @@ func (p *boolValue) Set(s string) error {
 	return nil
 }
 
+type countValue int
+
+func newCountValue(p *int) *countValue {
+	*p = 0
+	return (*countValue)(p)
+}
+
+func (p *countValue) IsBoolFlag() bool { return true }
+
+func (p *countValue) String() string { return strconv.Itoa((int)(*p)) }
+
+func (p *countValue) Get() interface{} { return (int)(*p) }
+
+func (p *countValue) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	if v {
+		*p++
+	}
+	return nil
+}
+
+// byteSuffixes lists the unit suffixes used to format byte quantities in
+// descending order of magnitude for each of the binary and decimal systems.
+var byteSuffixes = []quantitySuffix{
+	{"EiB", new(big.Rat).SetInt64(1 << 60)},
+	{"PiB", new(big.Rat).SetInt64(1 << 50)},
+	{"TiB", new(big.Rat).SetInt64(1 << 40)},
+	{"GiB", new(big.Rat).SetInt64(1 << 30)},
+	{"MiB", new(big.Rat).SetInt64(1 << 20)},
+	{"KiB", new(big.Rat).SetInt64(1 << 10)},
+	{"EB", new(big.Rat).SetInt64(1e18)},
+	{"PB", new(big.Rat).SetInt64(1e15)},
+	{"TB", new(big.Rat).SetInt64(1e12)},
+	{"GB", new(big.Rat).SetInt64(1e9)},
+	{"MB", new(big.Rat).SetInt64(1e6)},
+	{"kB", new(big.Rat).SetInt64(1e3)},
+}
+
+// byteParseSuffixes lists all unit suffixes accepted in byte quantities,
+// including the abbreviated forms without a trailing "B".
+var byteParseSuffixes = append(
+	append([]quantitySuffix{}, byteSuffixes...),
+	quantitySuffix{"KB", new(big.Rat).SetInt64(1e3)},
+	quantitySuffix{"B", new(big.Rat).SetInt64(1)},
+	quantitySuffix{"Ei", new(big.Rat).SetInt64(1 << 60)},
+	quantitySuffix{"Pi", new(big.Rat).SetInt64(1 << 50)},
+	quantitySuffix{"Ti", new(big.Rat).SetInt64(1 << 40)},
+	quantitySuffix{"Gi", new(big.Rat).SetInt64(1 << 30)},
+	quantitySuffix{"Mi", new(big.Rat).SetInt64(1 << 20)},
+	quantitySuffix{"Ki", new(big.Rat).SetInt64(1 << 10)},
+	quantitySuffix{"E", new(big.Rat).SetInt64(1e18)},
+	quantitySuffix{"P", new(big.Rat).SetInt64(1e15)},
+	quantitySuffix{"T", new(big.Rat).SetInt64(1e12)},
+	quantitySuffix{"G", new(big.Rat).SetInt64(1e9)},
+	quantitySuffix{"M", new(big.Rat).SetInt64(1e6)},
+	quantitySuffix{"K", new(big.Rat).SetInt64(1e3)},
+	quantitySuffix{"k", new(big.Rat).SetInt64(1e3)},
+)
+
+type bytesValue int64
+
+func newBytesValue(val int64, p *int64) *bytesValue {
+	*p = val
+	return (*bytesValue)(p)
+}
+
+func (p *bytesValue) String() string {
+	s := formatScaled(int64(*p), byteSuffixes)
+	if c := s[len(s)-1]; c >= '0' && c <= '9' {
+		s += "B"
+	}
+	return s
+}
+
+func (p *bytesValue) Get() interface{} { return (int64)(*p) }
+
+func (p *bytesValue) Set(s string) error {
+	v, err := parseScaled(s, byteParseSuffixes, 1)
+	if err != nil {
+		return err
+	}
+	*p = bytesValue(v)
+	return nil
+}
+
 type durationValue time.Duration
 
 func newDurationValue(val time.Duration, p *time.Duration) *durationValue {
@@ -106,6 +253,77 @@ func (p *durationValue) Set(s string) error {
 	return nil
 }
 
+type durationSliceValue struct {
+	p   *[]time.Duration
+	hot bool
+}
+
+func newDurationSliceValue(val []time.Duration, p *[]time.Duration) *durationSliceValue {
+	*p = val
+	return &durationSliceValue{p: p}
+}
+
+func (p *durationSliceValue) String() string {
+	if p.p == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", *p.p)
+}
+
+func (p *durationSliceValue) Get() interface{} { return *p.p }
+
+func (p *durationSliceValue) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	if !p.hot {
+		*p.p = make([]time.Duration, 0, 1)
+		p.hot = true
+	}
+	*p.p = append(*p.p, v)
+	return nil
+}
+
+type enumValue[T comparable] struct {
+	p       *T
+	mapping map[string]T
+}
+
+func newEnumValue[T comparable](p *T, mapping map[string]T) *enumValue[T] {
+	return &enumValue[T]{p: p, mapping: mapping}
+}
+
+// keys returns the keys of the mapping in lexical order.
+func (p *enumValue[T]) keys() []string {
+	keys := make([]string, 0, len(p.mapping))
+	for key := range p.mapping {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (p *enumValue[T]) String() string {
+	for _, key := range p.keys() {
+		if p.mapping[key] == *p.p {
+			return key
+		}
+	}
+	return ""
+}
+
+func (p *enumValue[T]) Get() interface{} { return *p.p }
+
+func (p *enumValue[T]) Set(s string) error {
+	v, ok := p.mapping[s]
+	if !ok {
+		return fmt.Errorf("must be one of: %s", strings.Join(p.keys(), ", "))
+	}
+	*p.p = v
+	return nil
+}
+
 type float64Value float64
 
 func newFloat64Value(val float64, p *float64) *float64Value {
@@ -128,10 +346,247 @@ func (p *float64Value) Set(s string) error {
 	return nil
 }
 
+type float32Value float32
+
+func newFloat32Value(val float32, p *float32) *float32Value {
+	*p = val
+	return (*float32Value)(p)
+}
+
+func (p *float32Value) String() string {
+	return strconv.FormatFloat(float64(*p), 'g', -1, 32)
+}
+
+func (p *float32Value) Get() interface{} { return (float32)(*p) }
+
+func (p *float32Value) Set(s string) error {
+	v, err := strconv.ParseFloat(s, 32)
+	if err != nil {
+		return numError(err, "float32", s)
+	}
+	*p = float32Value(v)
+	return nil
+}
+
+type bigIntValue big.Int
+
+func newBigIntValue(val *big.Int, p *big.Int) *bigIntValue {
+	p.Set(val)
+	return (*bigIntValue)(p)
+}
+
+func (p *bigIntValue) String() string { return (*big.Int)(p).String() }
+
+func (p *bigIntValue) Get() interface{} { return (*big.Int)(p) }
+
+func (p *bigIntValue) Set(s string) error {
+	v, ok := new(big.Int).SetString(s, numberBase(s))
+	if !ok {
+		return fmt.Errorf("invalid integer: %s", s)
+	}
+	(*big.Int)(p).Set(v)
+	return nil
+}
+
+type bigFloatValue big.Float
+
+func newBigFloatValue(val *big.Float, p *big.Float) *bigFloatValue {
+	p.Set(val)
+	return (*bigFloatValue)(p)
+}
+
+func (p *bigFloatValue) String() string { return (*big.Float)(p).Text('g', -1) }
+
+func (p *bigFloatValue) Get() interface{} { return (*big.Float)(p) }
+
+func (p *bigFloatValue) Set(s string) error {
+	// parse with the precision of p, as SetString would
+	v := new(big.Float).SetPrec((*big.Float)(p).Prec())
+	if _, ok := v.SetString(s); !ok {
+		return fmt.Errorf("invalid number: %s", s)
+	}
+	(*big.Float)(p).Set(v)
+	return nil
+}
+
+type float64SliceValue struct {
+	p   *[]float64
+	hot bool
+}
+
+func newFloat64SliceValue(val []float64, p *[]float64) *float64SliceValue {
+	*p = val
+	return &float64SliceValue{p: p}
+}
+
+func (p *float64SliceValue) String() string {
+	if p.p == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", *p.p)
+}
+
+func (p *float64SliceValue) Get() interface{} { return *p.p }
+
+func (p *float64SliceValue) Set(s string) error {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	if !p.hot {
+		*p.p = make([]float64, 0, 1)
+		p.hot = true
+	}
+	*p.p = append(*p.p, v)
+	return nil
+}
+
+type forceReasonValue struct {
+	p      *bool
+	reason *string
+}
+
+func newForceReasonValue(p *bool, reason *string) *forceReasonValue {
+	*p, *reason = false, ""
+	return &forceReasonValue{p: p, reason: reason}
+}
+
+func (p *forceReasonValue) IsBoolFlag() bool { return true }
+
+func (p *forceReasonValue) String() string {
+	if p.p == nil {
+		return ""
+	}
+	if *p.reason != "" {
+		return *p.reason
+	}
+	return strconv.FormatBool(*p.p)
+}
+
+func (p *forceReasonValue) Get() interface{} { return *p.p }
+
+func (p *forceReasonValue) Set(s string) error {
+	if v, err := strconv.ParseBool(s); err == nil {
+		*p.p, *p.reason = v, ""
+		return nil
+	}
+	*p.p, *p.reason = true, s
+	return nil
+}
+
 type funcValue func(string) error
 
 func (f funcValue) Set(s string) error { return f(s) }
 
+// fixedInt is the set of signed integer types with a fixed bit width.
+type fixedInt interface {
+	int8 | int16 | int32
+}
+
+type fixedIntValue[T fixedInt] struct {
+	p        *T
+	bitSize  int
+	typeName string
+}
+
+func newFixedIntValue[T fixedInt](val T, p *T, bitSize int, typeName string) *fixedIntValue[T] {
+	*p = val
+	return &fixedIntValue[T]{p: p, bitSize: bitSize, typeName: typeName}
+}
+
+func (p *fixedIntValue[T]) String() string {
+	if p.p == nil {
+		return ""
+	}
+	return strconv.FormatInt(int64(*p.p), 10)
+}
+
+func (p *fixedIntValue[T]) Get() interface{} { return int64(*p.p) }
+
+func (p *fixedIntValue[T]) Set(s string) error {
+	v, err := parseInt(s, p.bitSize)
+	if err != nil {
+		return numError(err, p.typeName, s)
+	}
+	*p.p = T(v)
+	return nil
+}
+
+// fixedUint is the set of unsigned integer types with a fixed bit width.
+type fixedUint interface {
+	uint8 | uint16 | uint32
+}
+
+type fixedUintValue[T fixedUint] struct {
+	p        *T
+	bitSize  int
+	typeName string
+}
+
+func newFixedUintValue[T fixedUint](val T, p *T, bitSize int, typeName string) *fixedUintValue[T] {
+	*p = val
+	return &fixedUintValue[T]{p: p, bitSize: bitSize, typeName: typeName}
+}
+
+func (p *fixedUintValue[T]) String() string {
+	if p.p == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(*p.p), 10)
+}
+
+func (p *fixedUintValue[T]) Get() interface{} { return uint64(*p.p) }
+
+func (p *fixedUintValue[T]) Set(s string) error {
+	v, err := parseUint(s, p.bitSize)
+	if err != nil {
+		return numError(err, p.typeName, s)
+	}
+	*p.p = T(v)
+	return nil
+}
+
+// numberBase returns the base in which the integer s should be parsed. Integers
+// with a "0x", "0o" or "0b" prefix are parsed in hexadecimal, octal or binary
+// respectively. All other integers, including those with a leading zero, are
+// parsed in decimal.
+func numberBase(s string) int {
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+	if len(s) > 2 && s[0] == '0' {
+		switch s[1] {
+		case 'x', 'X', 'o', 'O', 'b', 'B':
+			return 0 // inferred from the prefix
+		}
+	}
+	return 10
+}
+
+// parseInt is like strconv.ParseInt but parses s in the base given by
+// numberBase.
+func parseInt(s string, bitSize int) (int64, error) {
+	return strconv.ParseInt(s, numberBase(s), bitSize)
+}
+
+// parseUint is like strconv.ParseUint but parses s in the base given by
+// numberBase.
+func parseUint(s string, bitSize int) (uint64, error) {
+	return strconv.ParseUint(s, numberBase(s), bitSize)
+}
+
+// numError returns a readable error for a failure to parse s as a number of
+// the named type.
+func numError(err error, typeName, s string) error {
+	if errors.Is(err, strconv.ErrRange) {
+		return fmt.Errorf("value out of range for %s: %s", typeName, s)
+	}
+	if errors.Is(err, strconv.ErrSyntax) {
+		return fmt.Errorf("invalid %s: %s", typeName, s)
+	}
+	return err
+}
+
 type intValue int
 
 func newIntValue(val int, p *int) *intValue {
@@ -146,7 +601,7 @@ func (p *intValue) String() string {
 func (p *intValue) Get() interface{} { return (int64)(*p) }
 
 func (p *intValue) Set(s string) error {
-	v, err := strconv.ParseInt(s, 10, 64)
+	v, err := parseInt(s, 64)
 	if err != nil {
 		return err
 	}
@@ -154,6 +609,38 @@ func (p *intValue) Set(s string) error {
 	return nil
 }
 
+type intSliceValue struct {
+	p   *[]int
+	hot bool
+}
+
+func newIntSliceValue(val []int, p *[]int) *intSliceValue {
+	*p = val
+	return &intSliceValue{p: p}
+}
+
+func (p *intSliceValue) String() string {
+	if p.p == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", *p.p)
+}
+
+func (p *intSliceValue) Get() interface{} { return *p.p }
+
+func (p *intSliceValue) Set(s string) error {
+	v, err := parseInt(s, strconv.IntSize)
+	if err != nil {
+		return err
+	}
+	if !p.hot {
+		*p.p = make([]int, 0, 1)
+		p.hot = true
+	}
+	*p.p = append(*p.p, int(v))
+	return nil
+}
+
 type int64Value int64
 
 func newInt64Value(val int64, p *int64) *int64Value {
@@ -168,7 +655,7 @@ func (p *int64Value) String() string {
 func (p *int64Value) Get() interface{} { return (int64)(*p) }
 
 func (p *int64Value) Set(s string) error {
-	v, err := strconv.ParseInt(s, 10, 64)
+	v, err := parseInt(s, 64)
 	if err != nil {
 		return err
 	}
@@ -176,6 +663,204 @@ func (p *int64Value) Set(s string) error {
 	return nil
 }
 
+type int64SliceValue struct {
+	p   *[]int64
+	hot bool
+}
+
+func newInt64SliceValue(val []int64, p *[]int64) *int64SliceValue {
+	*p = val
+	return &int64SliceValue{p: p}
+}
+
+func (p *int64SliceValue) String() string {
+	if p.p == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", *p.p)
+}
+
+func (p *int64SliceValue) Get() interface{} { return *p.p }
+
+func (p *int64SliceValue) Set(s string) error {
+	v, err := parseInt(s, 64)
+	if err != nil {
+		return err
+	}
+	if !p.hot {
+		*p.p = make([]int64, 0, 1)
+		p.hot = true
+	}
+	*p.p = append(*p.p, v)
+	return nil
+}
+
+type ipValue net.IP
+
+func newIPValue(val net.IP, p *net.IP) *ipValue {
+	*p = val
+	return (*ipValue)(p)
+}
+
+func (p *ipValue) String() string {
+	if len(*p) == 0 {
+		return ""
+	}
+	return (net.IP)(*p).String()
+}
+
+func (p *ipValue) Get() interface{} { return (net.IP)(*p) }
+
+func (p *ipValue) Set(s string) error {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return fmt.Errorf("invalid IP address: %s", s)
+	}
+	*p = ipValue(ip)
+	return nil
+}
+
+type ipNetValue net.IPNet
+
+func newIPNetValue(val net.IPNet, p *net.IPNet) *ipNetValue {
+	*p = val
+	return (*ipNetValue)(p)
+}
+
+func (p *ipNetValue) String() string {
+	if len(p.IP) == 0 {
+		return ""
+	}
+	return (*net.IPNet)(p).String()
+}
+
+func (p *ipNetValue) Get() interface{} { return (net.IPNet)(*p) }
+
+func (p *ipNetValue) Set(s string) error {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		return fmt.Errorf("invalid CIDR address: %s", s)
+	}
+	*p = ipNetValue(*ipNet)
+	return nil
+}
+
+// quantitySuffix is a unit suffix of a Kubernetes-style quantity.
+type quantitySuffix struct {
+	suffix string
+	mult   *big.Rat
+}
+
+// quantitySuffixes lists the supported quantity suffixes in descending order of
+// magnitude for each of the binary and decimal systems.
+var quantitySuffixes = []quantitySuffix{
+	{"Ei", new(big.Rat).SetInt64(1 << 60)},
+	{"Pi", new(big.Rat).SetInt64(1 << 50)},
+	{"Ti", new(big.Rat).SetInt64(1 << 40)},
+	{"Gi", new(big.Rat).SetInt64(1 << 30)},
+	{"Mi", new(big.Rat).SetInt64(1 << 20)},
+	{"Ki", new(big.Rat).SetInt64(1 << 10)},
+	{"E", new(big.Rat).SetInt64(1e18)},
+	{"P", new(big.Rat).SetInt64(1e15)},
+	{"T", new(big.Rat).SetInt64(1e12)},
+	{"G", new(big.Rat).SetInt64(1e9)},
+	{"M", new(big.Rat).SetInt64(1e6)},
+	{"k", new(big.Rat).SetInt64(1e3)},
+	{"m", big.NewRat(1, 1e3)},
+}
+
+// parseScaled parses a decimal number followed by one of the given unit
+// suffixes and returns the value in base units multiplied by scale. The result
+// must be a whole number that fits in an int64.
+func parseScaled(s string, suffixes []quantitySuffix, scale int64) (int64, error) {
+	i := 0
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		i++
+	}
+	for i < len(s) && (s[i] == '.' || (s[i] >= '0' && s[i] <= '9')) {
+		i++
+	}
+	num, suffix := s[:i], s[i:]
+	v, ok := new(big.Rat).SetString(num)
+	if !ok {
+		return 0, fmt.Errorf("invalid quantity: %q", s)
+	}
+	if suffix != "" {
+		ok = false
+		for _, unit := range suffixes {
+			if unit.suffix == suffix {
+				v.Mul(v, unit.mult)
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return 0, fmt.Errorf("invalid quantity suffix: %q", s)
+		}
+	}
+	v.Mul(v, new(big.Rat).SetInt64(scale))
+	if !v.IsInt() {
+		return 0, fmt.Errorf("quantity is not a whole number of units: %q", s)
+	}
+	if !v.Num().IsInt64() {
+		return 0, fmt.Errorf("quantity out of range: %q", s)
+	}
+	return v.Num().Int64(), nil
+}
+
+// formatScaled formats n in the most compact form using the unit suffix that
+// divides it exactly with the smallest quotient.
+func formatScaled(n int64, suffixes []quantitySuffix) string {
+	s := strconv.FormatInt(n, 10)
+	if n == 0 {
+		return s
+	}
+	v, min := new(big.Rat).SetInt64(n), new(big.Rat).SetInt64(n)
+	min.Abs(min)
+	for _, unit := range suffixes {
+		if !unit.mult.IsInt() {
+			continue
+		}
+		q := new(big.Rat).Quo(v, unit.mult)
+		if !q.IsInt() || new(big.Rat).Abs(q).Cmp(min) >= 0 {
+			continue
+		}
+		s = q.Num().String() + unit.suffix
+		min.Abs(q)
+	}
+	return s
+}
+
+type quantityValue struct {
+	p     *int64
+	scale int64
+}
+
+func newQuantityValue(p *int64, scale int64) *quantityValue {
+	return &quantityValue{p: p, scale: scale}
+}
+
+func (p *quantityValue) String() string {
+	if p.p == nil {
+		return ""
+	}
+	if p.scale > 1 && *p.p%p.scale != 0 {
+		return strconv.FormatInt(*p.p, 10) + "m"
+	}
+	return formatScaled(*p.p/p.scale, quantitySuffixes)
+}
+
+func (p *quantityValue) Get() interface{} { return *p.p }
+
+func (p *quantityValue) Set(s string) error {
+	v, err := parseScaled(s, quantitySuffixes, p.scale)
+	if err != nil {
+		return err
+	}
+	*p.p = v
+	return nil
+}
+
 type stringValue string
 
 func newStringValue(val string, p *string) *stringValue {
@@ -192,6 +877,93 @@ func (p *stringValue) Set(s string) error {
 	return nil
 }
 
+type fileValue struct {
+	p      **os.File
+	path   string
+	flag   int
+	perm   os.FileMode
+	opened []*os.File
+	cmd    *Command // declaring command, for its input and output streams
+}
+
+func newFileValue(p **os.File, flag int, perm os.FileMode) *fileValue {
+	*p = nil
+	return &fileValue{p: p, flag: flag, perm: perm}
+}
+
+func (p *fileValue) String() string { return p.path }
+
+func (p *fileValue) Get() interface{} { return *p.p }
+
+func (p *fileValue) Set(s string) error {
+	if s == "-" {
+		f, err := p.std()
+		if err != nil {
+			return err
+		}
+		*p.p, p.path = f, s
+		return nil
+	}
+	f, err := os.OpenFile(s, p.flag, p.perm)
+	if err != nil {
+		return err
+	}
+	p.opened = append(p.opened, f)
+	*p.p, p.path = f, s
+	return nil
+}
+
+// std returns the output stream of the declaring command if the file is opened
+// for writing, or its input stream otherwise. The stream must be an *os.File.
+func (p *fileValue) std() (*os.File, error) {
+	if p.flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		var w io.Writer = os.Stdout
+		if p.cmd != nil {
+			w, _ = p.cmd.output()
+		}
+		if f, ok := w.(*os.File); ok {
+			return f, nil
+		}
+		return nil, errors.New("standard output is not a file")
+	}
+	var r io.Reader = os.Stdin
+	if p.cmd != nil {
+		r = p.cmd.input()
+	}
+	if f, ok := r.(*os.File); ok {
+		return f, nil
+	}
+	return nil, errors.New("standard input is not a file")
+}
+
+// Close closes all files opened by the flag.
+func (p *fileValue) Close() error {
+	var err error
+	for _, f := range p.opened {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	p.opened = nil
+	return err
+}
+
+type pathValue string
+
+func newPathValue(val string, p *string) *pathValue {
+	*p = val
+	return (*pathValue)(p)
+}
+
+func (p *pathValue) String() string { return (string)(*p) }
+
+func (p *pathValue) Get() interface{} { return (string)(*p) }
+
+func (p *pathValue) Set(s string) error {
+	*p = pathValue(s)
+	return nil
+}
+
 type stringSliceValue struct {
 	p   *[]string
 	hot bool
@@ -203,6 +975,9 @@ func newStringSliceValue(val []string, p *[]string) *stringSliceValue {
 }
 
 func (p *stringSliceValue) String() string {
+	if p.p == nil {
+		return ""
+	}
 	return fmt.Sprintf("%v", *p.p)
 }
 
@@ -217,6 +992,84 @@ func (p *stringSliceValue) Set(s string) error {
 	return nil
 }
 
+type stringMapValue struct {
+	p   *map[string]string
+	hot bool
+}
+
+func newStringMapValue(val map[string]string, p *map[string]string) *stringMapValue {
+	*p = val
+	return &stringMapValue{p: p}
+}
+
+func (p *stringMapValue) String() string {
+	if p.p == nil || *p.p == nil {
+		return ""
+	}
+	keys := make([]string, 0, len(*p.p))
+	for k := range *p.p {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + (*p.p)[k]
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (p *stringMapValue) Get() interface{} { return *p.p }
+
+func (p *stringMapValue) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i < 0 {
+		return fmt.Errorf("expected key=value, got: %q", s)
+	}
+	if !p.hot {
+		*p.p = make(map[string]string)
+		p.hot = true
+	}
+	(*p.p)[s[:i]] = s[i+1:]
+	return nil
+}
+
+type timeValue struct {
+	p       *time.Time
+	layouts []string
+}
+
+func newTimeValue(val time.Time, p *time.Time, layout string) *timeValue {
+	*p = val
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	return &timeValue{p: p, layouts: []string{layout}}
+}
+
+func (p *timeValue) String() string {
+	if p.p == nil {
+		return ""
+	}
+	if p.p.IsZero() {
+		return ""
+	}
+	return p.p.Format(p.layouts[0])
+}
+
+func (p *timeValue) Get() interface{} { return *p.p }
+
+func (p *timeValue) Set(s string) error {
+	var err error
+	for _, layout := range p.layouts {
+		var v time.Time
+		if v, err = time.Parse(layout, s); err == nil {
+			*p.p = v
+			return nil
+		}
+	}
+	return err
+}
+
 type uintValue uint
 
 func newUintValue(val uint, p *uint) *uintValue {
@@ -231,7 +1084,7 @@ func (p *uintValue) String() string {
 func (p *uintValue) Get() interface{} { return (int64)(*p) }
 
 func (p *uintValue) Set(s string) error {
-	v, err := strconv.ParseInt(s, 10, 64)
+	v, err := parseUint(s, 64)
 	if err != nil {
 		return err
 	}
@@ -247,16 +1100,88 @@ func newUint64Value(val uint64, p *uint64) *uint64Value {
 }
 
 func (p *uint64Value) String() string {
-	return strconv.FormatInt((int64)(*p), 10)
+	return strconv.FormatUint((uint64)(*p), 10)
 }
 
 func (p *uint64Value) Get() interface{} { return (int64)(*p) }
 
 func (p *uint64Value) Set(s string) error {
-	v, err := strconv.ParseInt(s, 10, 64)
+	v, err := parseUint(s, 64)
 	if err != nil {
 		return err
 	}
 	*p = uint64Value(v)
 	return nil
 }
+
+type uint64SliceValue struct {
+	p   *[]uint64
+	hot bool
+}
+
+func newUint64SliceValue(val []uint64, p *[]uint64) *uint64SliceValue {
+	*p = val
+	return &uint64SliceValue{p: p}
+}
+
+func (p *uint64SliceValue) String() string {
+	if p.p == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", *p.p)
+}
+
+func (p *uint64SliceValue) Get() interface{} { return *p.p }
+
+func (p *uint64SliceValue) Set(s string) error {
+	v, err := parseUint(s, 64)
+	if err != nil {
+		return err
+	}
+	if !p.hot {
+		*p.p = make([]uint64, 0, 1)
+		p.hot = true
+	}
+	*p.p = append(*p.p, v)
+	return nil
+}
+
+type urlValue struct {
+	p       **url.URL
+	schemes []string
+}
+
+func newURLValue(val *url.URL, p **url.URL) *urlValue {
+	*p = val
+	return &urlValue{p: p}
+}
+
+func (p *urlValue) String() string {
+	if p.p == nil || *p.p == nil {
+		return ""
+	}
+	return (*p.p).String()
+}
+
+func (p *urlValue) Get() interface{} { return *p.p }
+
+func (p *urlValue) Set(s string) error {
+	v, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if len(p.schemes) > 0 {
+		ok := false
+		for _, scheme := range p.schemes {
+			if strings.EqualFold(scheme, v.Scheme) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("URL scheme must be one of: %s", strings.Join(p.schemes, ", "))
+		}
+	}
+	*p.p = v
+	return nil
+}
@@ -1,7 +1,11 @@
 package xflags
 
 import (
+	"context"
 	"fmt"
+	"math/big"
+	"net"
+	"net/url"
 	"os"
 	"time"
 )
@@ -22,6 +26,24 @@ func Run(cmd Commander) int {
 	return RunWithArgs(cmd, os.Args[1:]...)
 }
 
+// RunContext is like Run but passes the given context to any handler
+// registered with CommandBuilder.HandleFuncC. This allows handlers to observe
+// cancellation, such as from signal.NotifyContext.
+//
+//     func main() {
+//         ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+//         defer stop()
+//         os.Exit(xflags.RunContext(ctx, cmd))
+//     }
+func RunContext(ctx context.Context, cmd Commander) int {
+	c, err := cmd.Command()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return c.RunContext(ctx, os.Args[1:])
+}
+
 // Run parses the given arguments and executes the handler for the command or
 // subcommand specified by the arguments.
 //
@@ -62,20 +84,98 @@ func Var(value Value, name, usage string) *FlagBuilder {
 	return c
 }
 
+// Accumulate returns a FlagBuilder that can be used to define a flag of any
+// type with specified name and usage string whose values are combined rather
+// than replaced. Each argument is parsed with parse and combined with the
+// current value of the variable that p points to using combine. E.g. to sum
+// integers or merge sets. The variable is not modified if the flag is not
+// specified, so its value at the time Accumulate is called is the default and
+// is the first value combined.
+//
+// The flag may be specified any number of times.
+func Accumulate[T any](
+	p *T,
+	name, usage string,
+	parse func(s string) (T, error),
+	combine func(acc, v T) T,
+) *FlagBuilder {
+	value := *p
+	return Var(newAccumulateValue(p, parse, combine), name, usage).
+		NArgs(0, 0).
+		resetTo(func() { *p = value })
+}
+
 // BitField returns a FlagBuilder that can be used to define a uint64 flag
 // with specified name, default value, and usage string. The argument p points
 // to a uint64 variable in which to toggle each of the bits in the mask
 // argument. You can specify multiple BitFieldVars to toggle bits in the same
 // underlying uint64.
 func BitField(p *uint64, mask uint64, name string, value bool, usage string) *FlagBuilder {
-	return Var(newBitFieldValue(value, p, mask), name, usage)
+	v := newBitFieldValue(value, p, mask)
+	initial := *p & mask
+	return Var(v, name, usage).resetTo(func() {
+		*p = *p&^mask | initial
+	})
+}
+
+// BitFlags returns a FlagBuilder that can be used to define a uint64 flag with
+// specified name and usage string which ORs each value given into the variable
+// that p points to. E.g. "--features 0x1 --features 0x4" sets bits 0x5. Values
+// may have a "0x", "0o" or "0b" prefix. If mask is non-zero, values with bits
+// outside of mask are rejected. Like Accumulate, the value of the variable at
+// the time BitFlags is called is the default.
+func BitFlags(p *uint64, mask uint64, name, usage string) *FlagBuilder {
+	value := *p
+	v := newAccumulateValue(
+		p,
+		func(s string) (uint64, error) {
+			n, err := parseUint(s, 64)
+			if err != nil {
+				return 0, numError(err, "uint64", s)
+			}
+			if mask != 0 && n&^mask != 0 {
+				return 0, fmt.Errorf("value 0x%x has bits outside of mask 0x%x", n, mask)
+			}
+			return n, nil
+		},
+		func(acc, v uint64) uint64 { return acc | v },
+	)
+	v.format = func(n uint64) string { return fmt.Sprintf("0x%x", n) }
+	return Var(v, name, usage).NArgs(0, 0).resetTo(func() { *p = value })
 }
 
 // Bool returns a FlagBuilder that can be used to define a bool flag with
 // specified name, default value, and usage string. The argument p points to a
 // bool variable in which to store the value of the flag.
+//
+// A bool flag specified without a value is set to true. An explicit value may
+// be given as --flag=value or -f=value and is parsed with strconv.ParseBool,
+// which accepts 1, t, T, TRUE, true, True, 0, f, F, FALSE, false and False.
+// The following argument is never consumed as the value of a bool flag.
 func Bool(p *bool, name string, value bool, usage string) *FlagBuilder {
-	return Var(newBoolValue(value, p), name, usage)
+	return Var(newBoolValue(value, p), name, usage).resetTo(func() { *p = value })
+}
+
+// Bytes returns a FlagBuilder that can be used to define an int64 flag with
+// specified name, default value, and usage string which accepts a number of
+// bytes with an optional decimal (kB, MB, GB, ...) or binary (KiB, MiB, GiB,
+// ...) unit suffix. E.g. "10MB", "512KiB" or "1.5G". The trailing "B" of a unit
+// may be omitted. The argument p points to an int64 variable in which to store
+// the number of bytes.
+func Bytes(p *int64, name string, value int64, usage string) *FlagBuilder {
+	return Var(newBytesValue(value, p), name, usage).resetTo(func() { *p = value })
+}
+
+// Count returns a FlagBuilder that can be used to define a counting flag with
+// specified name and usage string. The argument p points to an int variable
+// which is incremented each time the flag is specified on the command line.
+// Like a bool flag, no value is consumed from the command line.
+//
+// The flag may be specified any number of times. Use NArgs to set an upper
+// bound. For example, "-v -v -v" sets p to 3, as does "-vvv" since combined
+// short flags are expanded by the parser.
+func Count(p *int, name, usage string) *FlagBuilder {
+	return Var(newCountValue(p), name, usage).NArgs(0, 0).resetTo(func() { *p = 0 })
 }
 
 // Duration returns a FlagBuilder that can be used to define a time.Duration
@@ -83,14 +183,104 @@ func Bool(p *bool, name string, value bool, usage string) *FlagBuilder {
 // points to a time.Duration variable in which to store the value of the flag.
 // The flag accepts a value acceptable to time.ParseDuration.
 func Duration(p *time.Duration, name string, value time.Duration, usage string) *FlagBuilder {
-	return Var(newDurationValue(value, p), name, usage)
+	return Var(newDurationValue(value, p), name, usage).resetTo(func() { *p = value })
+}
+
+// Durations returns a FlagBuilder that can be used to define a time.Duration
+// slice flag with specified name, default value, and usage string. The argument
+// p points to a time.Duration slice variable in which each flag value will be
+// stored in command line order.
+func Durations(p *[]time.Duration, name string, value []time.Duration, usage string) *FlagBuilder {
+	v := newDurationSliceValue(value, p)
+	return Var(v, name, usage).NArgs(0, 0).resetTo(func() { *p, v.hot = value, false })
+}
+
+// Enum returns a FlagBuilder that can be used to define a flag of any
+// comparable type with specified name and usage string. The flag value must be
+// one of the keys of mapping and the corresponding value is stored in the
+// variable that p points to. The variable is not modified if the flag is not
+// specified, so its value at the time Enum is called is the default.
+func Enum[T comparable](p *T, name, usage string, mapping map[string]T) *FlagBuilder {
+	v, value := newEnumValue(p, mapping), *p
+	c := Var(v, name, usage).resetTo(func() { *p = value })
+	c.flag.Choices = v.keys()
+	return c
+}
+
+// BigFloat returns a FlagBuilder that can be used to define an arbitrary
+// precision floating-point flag with specified name, default value, and usage
+// string. The argument p points to a big.Float in which to store the value of
+// the flag. A nil default value is zero.
+//
+// Values are parsed with big.Float.SetString using the precision of p, which is
+// set to 64 bits if it is zero.
+func BigFloat(p *big.Float, name string, value *big.Float, usage string) *FlagBuilder {
+	def := new(big.Float)
+	if value != nil {
+		def.Set(value)
+	}
+	return Var(newBigFloatValue(def, p), name, usage).resetTo(func() { p.Set(def) })
+}
+
+// BigInt returns a FlagBuilder that can be used to define an arbitrary
+// precision integer flag with specified name, default value, and usage string.
+// The argument p points to a big.Int in which to store the value of the flag. A
+// nil default value is zero. Like Int64, values may have a "0x", "0o" or "0b"
+// prefix.
+func BigInt(p *big.Int, name string, value *big.Int, usage string) *FlagBuilder {
+	def := new(big.Int)
+	if value != nil {
+		def.Set(value)
+	}
+	return Var(newBigIntValue(def, p), name, usage).resetTo(func() { p.Set(def) })
+}
+
+// FilePath returns a FlagBuilder that can be used to define a file path flag
+// with specified name, default value, and usage string. The argument p points
+// to a string variable in which to store the value of the flag. Use
+// FlagBuilder.MustExist, FlagBuilder.MustBeFile or FlagBuilder.MustBeDir to
+// check the path when it is parsed.
+func FilePath(p *string, name, value, usage string) *FlagBuilder {
+	return Var(newPathValue(value, p), name, usage).resetTo(func() { *p = value })
+}
+
+// Float32 returns a FlagBuilder that can be used to define a float32 flag
+// with specified name, default value, and usage string. The argument p points
+// to a float32 variable in which to store the value of the flag. Values outside
+// the range of a float32 are rejected.
+func Float32(p *float32, name string, value float32, usage string) *FlagBuilder {
+	return Var(newFloat32Value(value, p), name, usage).resetTo(func() { *p = value })
 }
 
 // Float64 returns a FlagBuilder that can be used to define a float64 flag
 // with specified name, default value, and usage string. The argument p points
 // to a float64 variable in which to store the value of the flag.
 func Float64(p *float64, name string, value float64, usage string) *FlagBuilder {
-	return Var(newFloat64Value(value, p), name, usage)
+	return Var(newFloat64Value(value, p), name, usage).resetTo(func() { *p = value })
+}
+
+// Float64s returns a FlagBuilder that can be used to define a float64 slice
+// flag with specified name, default value, and usage string. The argument p
+// points to a float64 slice variable in which each flag value will be stored in
+// command line order.
+func Float64s(p *[]float64, name string, value []float64, usage string) *FlagBuilder {
+	v := newFloat64SliceValue(value, p)
+	return Var(v, name, usage).NArgs(0, 0).resetTo(func() { *p, v.hot = value, false })
+}
+
+// ForceReason returns a FlagBuilder that can be used to define a bool flag
+// with specified name and usage string which may optionally carry a reason.
+// The argument p points to a bool variable which is set to true if the flag is
+// specified. The argument reason points to a string variable in which to store
+// any value given with "=".
+//
+// For example, "--force" sets p to true and leaves reason empty, while
+// "--force='maintenance window'" sets p to true and reason to
+// "maintenance window". A boolean value, as accepted by strconv.ParseBool, is
+// not a reason: "--force=false" sets p to false and clears reason, including
+// when the value comes from an environment variable or config file.
+func ForceReason(p *bool, reason *string, name, usage string) *FlagBuilder {
+	return Var(newForceReasonValue(p, reason), name, usage).resetTo(func() { *p, *reason = false, "" })
 }
 
 // Func returns a FlagBuilder that can used to define a flag with the specified name and usage
@@ -105,40 +295,203 @@ func Func(name, usage string, fn func(s string) error) *FlagBuilder {
 // specified name, default value, and usage string. The argument p points to an
 // int variable in which to store the value of the flag.
 func Int(p *int, name string, value int, usage string) *FlagBuilder {
-	return Var(newIntValue(value, p), name, usage)
+	return Var(newIntValue(value, p), name, usage).resetTo(func() { *p = value })
+}
+
+// Ints returns a FlagBuilder that can be used to define an int slice flag with
+// specified name, default value, and usage string. The argument p points to an
+// int slice variable in which each flag value will be stored in command line
+// order.
+func Ints(p *[]int, name string, value []int, usage string) *FlagBuilder {
+	v := newIntSliceValue(value, p)
+	return Var(v, name, usage).NArgs(0, 0).resetTo(func() { *p, v.hot = value, false })
+}
+
+// Int8 returns a FlagBuilder that can be used to define an int8 flag with
+// specified name, default value, and usage string. The argument p points to an
+// int8 variable in which to store the value of the flag. Values outside the
+// range of an int8 are rejected.
+func Int8(p *int8, name string, value int8, usage string) *FlagBuilder {
+	return Var(newFixedIntValue(value, p, 8, "int8"), name, usage).resetTo(func() { *p = value })
+}
+
+// Int16 returns a FlagBuilder that can be used to define an int16 flag with
+// specified name, default value, and usage string. The argument p points to an
+// int16 variable in which to store the value of the flag. Values outside the
+// range of an int16 are rejected.
+func Int16(p *int16, name string, value int16, usage string) *FlagBuilder {
+	return Var(newFixedIntValue(value, p, 16, "int16"), name, usage).resetTo(func() { *p = value })
+}
+
+// Int32 returns a FlagBuilder that can be used to define an int32 flag with
+// specified name, default value, and usage string. The argument p points to an
+// int32 variable in which to store the value of the flag. Values outside the
+// range of an int32 are rejected.
+func Int32(p *int32, name string, value int32, usage string) *FlagBuilder {
+	return Var(newFixedIntValue(value, p, 32, "int32"), name, usage).resetTo(func() { *p = value })
 }
 
 // Int64 returns a FlagBuilder that can be used to define an int64 flag with
 // specified name, default value, and usage string. The argument p points to an
 // int64 variable in which to store the value of the flag.
 func Int64(p *int64, name string, value int64, usage string) *FlagBuilder {
-	return Var(newInt64Value(value, p), name, usage)
+	return Var(newInt64Value(value, p), name, usage).resetTo(func() { *p = value })
+}
+
+// Int64s returns a FlagBuilder that can be used to define an int64 slice flag
+// with specified name, default value, and usage string. The argument p points
+// to an int64 slice variable in which each flag value will be stored in command
+// line order.
+func Int64s(p *[]int64, name string, value []int64, usage string) *FlagBuilder {
+	v := newInt64SliceValue(value, p)
+	return Var(v, name, usage).NArgs(0, 0).resetTo(func() { *p, v.hot = value, false })
+}
+
+// IP returns a FlagBuilder that can be used to define a net.IP flag with
+// specified name, default value, and usage string. The argument p points to a
+// net.IP variable in which to store the value of the flag. The flag accepts an
+// IPv4 or IPv6 address acceptable to net.ParseIP.
+func IP(p *net.IP, name string, value net.IP, usage string) *FlagBuilder {
+	return Var(newIPValue(value, p), name, usage).resetTo(func() { *p = value })
+}
+
+// IPNet returns a FlagBuilder that can be used to define a net.IPNet flag with
+// specified name, default value, and usage string. The argument p points to a
+// net.IPNet variable in which to store the value of the flag. The flag accepts
+// a CIDR notation address acceptable to net.ParseCIDR, such as "192.0.2.0/24".
+func IPNet(p *net.IPNet, name string, value net.IPNet, usage string) *FlagBuilder {
+	return Var(newIPNetValue(value, p), name, usage).resetTo(func() { *p = value })
+}
+
+// OpenFile returns a FlagBuilder that can be used to define a file flag with
+// specified name and usage string. The file named by the flag is opened during
+// parsing with os.OpenFile using the given flag and perm and the argument p
+// points to an *os.File variable in which to store the open file. If the flag
+// is not specified, p is set to nil.
+//
+// The name "-" refers to the standard output of the command, as set with
+// CommandBuilder.Output, if flag includes os.O_WRONLY or os.O_RDWR, and to its
+// standard input, as set with CommandBuilder.Input, otherwise. Unlike other
+// flags which read the standard input, the stream must be an *os.File.
+//
+// The program is responsible for closing the file. Command.Close closes all
+// files opened by a command and its ancestors, except the standard input and
+// output. Files are also closed when the command is reset and when parsing
+// fails.
+func OpenFile(p **os.File, name, usage string, flag int, perm os.FileMode) *FlagBuilder {
+	v := newFileValue(p, flag, perm)
+	return Var(v, name, usage).resetTo(func() {
+		v.Close()
+		*p, v.path = nil, ""
+	})
+}
+
+// Quantity returns a FlagBuilder that can be used to define a flag with
+// specified name and usage string which accepts a Kubernetes-style quantity
+// such as "512Mi" or "2G". The argument p points to an int64 variable in which
+// to store the value of the flag in base units.
+//
+// Quantities are a decimal number followed by an optional binary suffix (Ki,
+// Mi, Gi, Ti, Pi, Ei), decimal suffix (k, M, G, T, P, E) or the milli suffix
+// (m). The value must be a whole number of base units.
+func Quantity(p *int64, name, usage string) *FlagBuilder {
+	value := *p
+	return Var(newQuantityValue(p, 1), name, usage).resetTo(func() { *p = value })
+}
+
+// MilliQuantity is like Quantity but stores the value of the flag in
+// thousandths of a unit so that quantities such as "500m" or "0.5" may be
+// expressed. For example, "2" is stored as 2000 and "500m" is stored as 500.
+func MilliQuantity(p *int64, name, usage string) *FlagBuilder {
+	value := *p
+	return Var(newQuantityValue(p, 1000), name, usage).resetTo(func() { *p = value })
 }
 
 // String returns a FlagBuilder that can be used to define a string flag with
 // specified name, default value, and usage string. The argument p points to a
 // string variable in which to store the value of the flag.
 func String(p *string, name, value, usage string) *FlagBuilder {
-	return Var(newStringValue(value, p), name, usage)
+	return Var(newStringValue(value, p), name, usage).resetTo(func() { *p = value })
 }
 
 // Strings returns a FlagBuilder that can be used to define a string slice flag with specified name,
 // default value, and usage string. The argument p points to a string slice variable in which each
 // flag value will be stored in command line order.
 func Strings(p *[]string, name string, value []string, usage string) *FlagBuilder {
-	return Var(newStringSliceValue(value, p), name, usage).NArgs(0, 0)
+	v := newStringSliceValue(value, p)
+	return Var(v, name, usage).NArgs(0, 0).resetTo(func() { *p, v.hot = value, false })
+}
+
+// StringMap returns a FlagBuilder that can be used to define a string map flag
+// with specified name and usage string. The argument p points to a map
+// variable in which each key=value pair is stored. Each occurrence of the flag
+// adds one pair to the map and repeated keys overwrite earlier values.
+func StringMap(p *map[string]string, name, usage string) *FlagBuilder {
+	v := newStringMapValue(nil, p)
+	return Var(v, name, usage).NArgs(0, 0).resetTo(func() { *p, v.hot = nil, false })
+}
+
+// Time returns a FlagBuilder that can be used to define a time.Time flag with
+// specified name, default value, layout and usage string. Values are parsed and
+// formatted using the given layout as defined by time.Parse. If layout is
+// empty, time.RFC3339 is used. Additional layouts may be accepted using
+// FlagBuilder.Layouts. The argument p points to a time.Time variable in which
+// to store the value of the flag.
+func Time(p *time.Time, name string, value time.Time, layout, usage string) *FlagBuilder {
+	return Var(newTimeValue(value, p, layout), name, usage).resetTo(func() { *p = value })
 }
 
 // Uint returns a FlagBuilder that can be used to define an uint flag with
 // specified name, default value, and usage string. The argument p points to an
 // uint variable in which to store the value of the flag.
 func Uint(p *uint, name string, value uint, usage string) *FlagBuilder {
-	return Var(newUintValue(value, p), name, usage)
+	return Var(newUintValue(value, p), name, usage).resetTo(func() { *p = value })
+}
+
+// Uint8 returns a FlagBuilder that can be used to define an uint8 flag with
+// specified name, default value, and usage string. The argument p points to an
+// uint8 variable in which to store the value of the flag. Values outside the
+// range of an uint8 are rejected.
+func Uint8(p *uint8, name string, value uint8, usage string) *FlagBuilder {
+	return Var(newFixedUintValue(value, p, 8, "uint8"), name, usage).resetTo(func() { *p = value })
+}
+
+// Uint16 returns a FlagBuilder that can be used to define an uint16 flag with
+// specified name, default value, and usage string. The argument p points to an
+// uint16 variable in which to store the value of the flag. Values outside the
+// range of an uint16 are rejected.
+func Uint16(p *uint16, name string, value uint16, usage string) *FlagBuilder {
+	return Var(newFixedUintValue(value, p, 16, "uint16"), name, usage).resetTo(func() { *p = value })
+}
+
+// Uint32 returns a FlagBuilder that can be used to define an uint32 flag with
+// specified name, default value, and usage string. The argument p points to an
+// uint32 variable in which to store the value of the flag. Values outside the
+// range of an uint32 are rejected.
+func Uint32(p *uint32, name string, value uint32, usage string) *FlagBuilder {
+	return Var(newFixedUintValue(value, p, 32, "uint32"), name, usage).resetTo(func() { *p = value })
 }
 
 // Uint64 returns a FlagBuilder that can be used to define an uint64 flag
 // with specified name, default value, and usage string. The argument p points
 // to an uint64 variable in which to store the value of the flag.
 func Uint64(p *uint64, name string, value uint64, usage string) *FlagBuilder {
-	return Var(newUint64Value(value, p), name, usage)
+	return Var(newUint64Value(value, p), name, usage).resetTo(func() { *p = value })
+}
+
+// Uint64s returns a FlagBuilder that can be used to define an uint64 slice flag
+// with specified name, default value, and usage string. The argument p points
+// to an uint64 slice variable in which each flag value will be stored in
+// command line order.
+func Uint64s(p *[]uint64, name string, value []uint64, usage string) *FlagBuilder {
+	v := newUint64SliceValue(value, p)
+	return Var(v, name, usage).NArgs(0, 0).resetTo(func() { *p, v.hot = value, false })
+}
+
+// URL returns a FlagBuilder that can be used to define a URL flag with
+// specified name, default value, and usage string. The argument p points to a
+// *url.URL variable in which to store the value of the flag. Values are parsed
+// with url.Parse. Use FlagBuilder.URLSchemes to restrict the accepted schemes.
+func URL(p **url.URL, name string, value *url.URL, usage string) *FlagBuilder {
+	return Var(newURLValue(value, p), name, usage).resetTo(func() { *p = value })
 }
@@ -1,11 +1,38 @@
 package xflags
 
 import (
+	"bytes"
 	"errors"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 	"time"
 )
 
+var update = flag.Bool("update", false, "update golden files")
+
+// assertGolden compares actual to the contents of the named file in testdata.
+// If the -update flag is given, the file is overwritten instead.
+func assertGolden(t *testing.T, name string, actual []byte) bool {
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(path, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return true
+	}
+	expect, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expect, actual) {
+		t.Errorf("%s: expected:\n%s\ngot:\n%s", name, expect, actual)
+		return false
+	}
+	return true
+}
+
 func assertBool(t *testing.T, expect, actual bool) bool {
 	if expect == actual {
 		return true
@@ -81,10 +108,40 @@ func assertFlagParses(t *testing.T, flag *Flag, args ...string) bool {
 	}
 	return true
 }
-func assertErrorAs(t *testing.T, err error, target error) bool {
-	if errors.As(err, &target) {
+
+func assertErrorAs(t *testing.T, err error, target interface{}) bool {
+	if errors.As(err, target) {
 		return true
 	}
 	t.Errorf("expected: %T, got: %T: %v", target, err, err)
 	return false
 }
+
+// newWidgetsCommand returns a command with subcommands, choices and completions
+// which is shared by the tests of completion scripts, man pages and help
+// output. Help and error messages are written to w.
+func newWidgetsCommand(w *bytes.Buffer) *Command {
+	var n int
+	var verbose bool
+	var color, format, name string
+	return NewCommand("widgets", "").
+		Output(w, w).
+		Flags(
+			Bool(&verbose, "verbose", false, "").ShortName("v"),
+			String(&color, "color", "auto", "").Choices("auto", "always", "never"),
+		).
+		Subcommands(
+			NewCommand("create", "").
+				Flags(
+					Int(&n, "n", 1, ""),
+					String(&format, "format", "", "").Choices("json", "text"),
+					String(&name, "name", "", "").CompleteFunc(func(prefix string) []string {
+						return []string{"gadget", "gizmo", "widget"}
+					}),
+				),
+			NewCommand("destroy", ""),
+			NewCommand("secret", "").Hidden(),
+		).
+		WithCompletion().
+		Must()
+}